@@ -60,6 +60,9 @@ func Test_ExistingCivoVolume(t *testing.T) {
 					Driver:       "csi.civo.com",
 					VolumeHandle: res.ID,
 					FSType:       "ext4",
+					VolumeAttributes: map[string]string{
+						"csi.civo.com/adopt": "true",
+					},
 				},
 			},
 		},
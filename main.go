@@ -7,6 +7,7 @@ import (
 	"os/signal"
 	"strings"
 	"syscall"
+	"text/template"
 
 	"github.com/civo/civo-csi/pkg/driver"
 
@@ -14,7 +15,23 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-var versionInfo = flag.Bool("version", false, "Print the driver version")
+var (
+	versionInfo          = flag.Bool("version", false, "Print the driver version")
+	mode                 = flag.String("mode", string(driver.ModeAll), "Which CSI services this instance is deployed for: controller, node or all")
+	healthAddress        = flag.String("health-address", "", "Address to serve the /healthz and /readyz endpoints on, e.g. :9808 (disabled if empty)")
+	filesystems          = flag.String("filesystems", driver.DefaultFilesystem, "Comma separated list of filesystems the node plugin must be able to format, mount and grow, e.g. ext4,xfs")
+	deviceWait           = flag.Duration("device-wait-timeout", driver.DefaultDeviceWaitTimeout, "How long staging waits for an attached volume to appear on the node")
+	udevSettle           = flag.Bool("udev-settle", false, "Trigger udev and wait for it to settle if an attached volume hasn't appeared on the node")
+	minVolumeSize        = flag.Int64("min-volume-size", driver.DefaultMinimumVolumeSizeGB, "Smallest volume in GB to create, smaller requests are rounded up to it")
+	maxVolumeSize        = flag.Int64("max-volume-size", driver.DefaultMaximumVolumeSizeGB, "Largest volume in GB to create or grow a volume to, 0 for no limit")
+	orphanScan           = flag.Duration("orphan-scan-interval", 0, "How often the controller looks for volumes in the cluster without a PersistentVolume, 0 to disable it")
+	orphanGrace          = flag.Duration("orphan-grace-period", driver.DefaultOrphanGracePeriod, "How long a volume must have been orphaned before it's deleted")
+	orphanDelete         = flag.String("orphan-deletion", string(driver.OrphanDeletionOff), "What happens to volumes orphaned for longer than the grace period: off, dry-run or on")
+	reconcileAttachments = flag.Duration("attachment-reconcile-interval", 0, "How often the controller detaches volumes from instances that are no longer in the cluster, 0 to disable it")
+	releasedNamespace    = flag.String("released-volumes-namespace", driver.DefaultReleasedVolumesNamespace, "Namespace of the ConfigMap recording the volumes released instead of being deleted")
+	volumeNameTemplate   = flag.String("volume-name-template", "", "text/template for the names of new Civo volumes, from .PVName, .PVCName and .PVCNamespace, e.g. {{ .PVCNamespace }}-{{ .PVCName }}-{{ .PVName }} (the PV's name if empty)")
+	listAll              = flag.Bool("list-all-volumes", false, "List every volume in the Civo account from ListVolumes, not only this cluster's")
+)
 
 func main() {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
@@ -26,6 +43,29 @@ func main() {
 		return
 	}
 
+	driverMode, err := driver.ParseMode(*mode)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid mode")
+	}
+
+	filesystemList, err := driver.ParseFilesystems(*filesystems)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid filesystems")
+	}
+
+	orphanDeletion, err := driver.ParseOrphanDeletion(*orphanDelete)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid orphan deletion")
+	}
+
+	var nameTemplate *template.Template
+	if *volumeNameTemplate != "" {
+		nameTemplate, err = driver.ParseVolumeNameTemplate(*volumeNameTemplate)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid volume name template")
+		}
+	}
+
 	apiURL := strings.TrimSpace(os.Getenv("CIVO_API_URL"))
 	apiKey := strings.TrimSpace(os.Getenv("CIVO_API_KEY"))
 	region := strings.TrimSpace(os.Getenv("CIVO_REGION"))
@@ -37,6 +77,29 @@ func main() {
 		log.Fatal().Err(err)
 	}
 
+	kubeClient, err := driver.NewInClusterKubernetesClient()
+	if err != nil {
+		log.Warn().Err(err).Msg("Unable to create a Kubernetes API client, Kubernetes events won't be recorded and volumes won't be deleted")
+	} else {
+		d.KubeClient = kubeClient
+		d.EventRecorder = driver.NewEventRecorder(kubeClient)
+	}
+
+	d.Mode = driverMode
+	d.HealthAddress = *healthAddress
+	d.Filesystems = filesystemList
+	d.DeviceWaitTimeout = *deviceWait
+	d.UdevSettle = *udevSettle
+	d.MinimumVolumeSizeGB = *minVolumeSize
+	d.MaximumVolumeSizeGB = *maxVolumeSize
+	d.ListAllVolumes = *listAll
+	d.VolumeNameTemplate = nameTemplate
+	d.OrphanScanInterval = *orphanScan
+	d.OrphanGracePeriod = *orphanGrace
+	d.OrphanDeletion = orphanDeletion
+	d.AttachmentReconcileInterval = *reconcileAttachments
+	d.ReleasedVolumesNamespace = *releasedNamespace
+
 	log.Info().Interface("d", d).Msg("Created a new driver")
 
 	log.Debug().Msg("Determining volumeType of cluster")
@@ -11,6 +11,7 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/sync/errgroup"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
 // TestCivoCSI runs the Sanity test suite
@@ -20,10 +21,12 @@ func TestCivoCSI(t *testing.T) {
 
 	fc, _ := civogo.NewFakeClient()
 	d, _ := driver.NewTestDriver(fc)
+	d.CivoClient = clusterFakeClient{fc}
+	d.KubeClient = fake.NewSimpleClientset()
 
 	ctx, cancel := context.WithCancel(context.Background())
 
-	os.Setenv("REGION", "TESTING1")
+	os.Setenv("REGION", d.Region) // the node has to be in the region the controller creates volumes in
 	os.Setenv("NAMESPACE", "default")
 	cluster, _ := d.CivoClient.NewKubernetesClusters(&civogo.KubernetesClusterConfig{
 		Name:           "test",
@@ -55,3 +58,23 @@ func TestCivoCSI(t *testing.T) {
 		t.Errorf("driver run failed: %s", err)
 	}
 }
+
+// clusterFakeClient keeps the cluster ID of the volumes it creates, which the
+// fake Civo API drops, so ListVolumes can find the cluster's volumes
+type clusterFakeClient struct {
+	*civogo.FakeClient
+}
+
+func (c clusterFakeClient) NewVolume(v *civogo.VolumeConfig) (*civogo.VolumeResult, error) {
+	result, err := c.FakeClient.NewVolume(v)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range c.Volumes {
+		if c.Volumes[i].ID == result.ID {
+			c.Volumes[i].ClusterID = v.ClusterID
+		}
+	}
+	return result, nil
+}
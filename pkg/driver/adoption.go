@@ -0,0 +1,57 @@
+package driver
+
+import (
+	"strings"
+
+	"github.com/civo/civogo"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// checkVolumeOwnership returns FailedPrecondition if the volume was created for another cluster that still exists.
+// Volumes that weren't created for a cluster, or whose cluster has been deleted, can be used by this one.
+func (d *Driver) checkVolumeOwnership(volume *civogo.Volume) error {
+	if d.ClusterID == "" || volume.ClusterID == "" || volume.ClusterID == d.ClusterID {
+		return nil
+	}
+
+	_, err := d.CivoClient.GetKubernetesCluster(volume.ClusterID)
+	if err != nil {
+		if strings.Contains(err.Error(), "DatabaseKubernetesClusterNotFound") || strings.Contains(err.Error(), "ZeroMatchesError") {
+			log.Debug().Str("volume_id", volume.ID).Str("cluster_id", volume.ClusterID).Msg("Volume's cluster no longer exists")
+			return nil
+		}
+		return status.Errorf(codes.Internal, "unable to find the cluster volume %q belongs to in the Civo API: %s", volume.ID, err)
+	}
+
+	return status.Errorf(codes.FailedPrecondition, "volume %q belongs to cluster %q, not this cluster %q", volume.ID, volume.ClusterID, d.ClusterID)
+}
+
+// checkAdoptable returns FailedPrecondition if an existing volume can't be adopted by the cluster, because it belongs
+// to another cluster, is on another network or is attached to an instance outside the cluster. Volumes in other
+// regions can't be found by the Civo API client at all.
+func (d *Driver) checkAdoptable(volume *civogo.Volume, cluster *civogo.KubernetesCluster) error {
+	if err := d.checkVolumeOwnership(volume); err != nil {
+		return err
+	}
+
+	if volume.NetworkID != "" && cluster.NetworkID != "" && volume.NetworkID != cluster.NetworkID {
+		return status.Errorf(codes.FailedPrecondition, "volume %q is on network %q, not the cluster's network %q", volume.ID, volume.NetworkID, cluster.NetworkID)
+	}
+
+	if volume.InstanceID != "" {
+		inCluster := false
+		for _, instance := range cluster.Instances {
+			if instance.ID == volume.InstanceID {
+				inCluster = true
+				break
+			}
+		}
+		if !inCluster {
+			return status.Errorf(codes.FailedPrecondition, "volume %q is attached to instance %q, which isn't in the cluster", volume.ID, volume.InstanceID)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/civo/civogo"
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// runAttachmentReconciler detaches stale attachments every AttachmentReconcileInterval until the context is cancelled
+func (d *Driver) runAttachmentReconciler(ctx context.Context) error {
+	log.Info().Dur("interval", d.AttachmentReconcileInterval).Msg("Reconciling volume attachments")
+
+	ticker := time.NewTicker(d.AttachmentReconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Debug().Msg("Stopping the attachment reconciler because the context was cancelled")
+			return nil
+		case <-ticker.C:
+			if err := d.ReconcileAttachments(ctx); err != nil {
+				log.Error().Err(err).Msg("Unable to reconcile volume attachments")
+			}
+		}
+	}
+}
+
+// ReconcileAttachments detaches the cluster's volumes that the Civo API reports as attached to an instance that's no
+// longer in the cluster, which happens if a node is deleted without its volumes being detached cleanly. Until they're
+// detached, ControllerPublishVolume can't attach them anywhere else. An instance counts as live if it's in the Civo
+// API's list of the cluster's instances or a CSINode still has it as this driver's node ID, so new nodes that the
+// Civo API doesn't list yet are never mistaken for deleted ones. An instance that isn't live may still be running and
+// using the volume, e.g. one it was attached to by hand, so a volume is only detached once the Civo API confirms its
+// instance no longer exists.
+func (d *Driver) ReconcileAttachments(ctx context.Context) error {
+	d.metrics.mu.Lock()
+	d.metrics.attachmentReconciles++
+	d.metrics.mu.Unlock()
+
+	stale, wantedBy, err := d.findStaleAttachments(ctx)
+	if err != nil {
+		d.metrics.mu.Lock()
+		d.metrics.attachmentReconcileFailures++
+		d.metrics.mu.Unlock()
+		return err
+	}
+
+	for _, volume := range stale {
+		node := wantedBy[volume.ID]
+
+		gone, err := d.instanceGone(volume.InstanceID)
+		if err != nil {
+			log.Error().Err(err).Str("volume_id", volume.ID).Str("instance_id", volume.InstanceID).Msg("Unable to check if the instance of a stale attachment still exists")
+			continue
+		}
+		if !gone {
+			log.Warn().Str("volume_id", volume.ID).Str("instance_id", volume.InstanceID).Msg("Not detaching volume from an instance outside the cluster that still exists")
+			d.recordVolumeEvent(ctx, volume.ID, v1.EventTypeWarning, "StaleAttachmentSkipped", "Not detaching volume %s from instance %s, which isn't in the cluster but still exists", volume.ID, volume.InstanceID)
+			continue
+		}
+
+		log.Warn().Str("volume_id", volume.ID).Str("instance_id", volume.InstanceID).Str("node", node).Msg("Detaching volume from an instance that's no longer in the cluster")
+
+		if _, err := d.CivoClient.DetachVolume(volume.ID); err != nil {
+			log.Error().Err(err).Str("volume_id", volume.ID).Msg("Unable to detach stale attachment in Civo API")
+			d.recordVolumeEvent(ctx, volume.ID, v1.EventTypeWarning, "StaleAttachmentDetachFailed", "Failed to detach volume %s from instance %s, which is no longer in the cluster: %s", volume.ID, volume.InstanceID, err)
+			continue
+		}
+
+		if node != "" {
+			d.recordVolumeEvent(ctx, volume.ID, v1.EventTypeNormal, "StaleAttachmentDetached", "Detached volume %s from instance %s, which is no longer in the cluster, its VolumeAttachment is for node %s", volume.ID, volume.InstanceID, node)
+		} else {
+			d.recordVolumeEvent(ctx, volume.ID, v1.EventTypeNormal, "StaleAttachmentDetached", "Detached volume %s from instance %s, which is no longer in the cluster", volume.ID, volume.InstanceID)
+		}
+
+		d.metrics.mu.Lock()
+		d.metrics.staleAttachmentsDetached++
+		d.metrics.mu.Unlock()
+	}
+
+	return nil
+}
+
+// findStaleAttachments returns the cluster's volumes attached to instances that aren't live, and the node each one's
+// VolumeAttachment wants it attached to, if it has one
+func (d *Driver) findStaleAttachments(ctx context.Context) ([]civogo.Volume, map[string]string, error) {
+	if d.ClusterID == "" {
+		return nil, nil, errors.New("stale attachments can't be found without a cluster ID")
+	}
+	if d.KubeClient == nil {
+		return nil, nil, errors.New("stale attachments can't be found without a Kubernetes API client")
+	}
+
+	// List the volumes first, so an instance they're attached to that's added to the cluster during the
+	// reconciliation is seen as live
+	volumes, err := d.CivoClient.ListVolumes()
+	if err != nil {
+		return nil, nil, fmt.Errorf("list volumes: %w", err)
+	}
+
+	cluster, err := d.CivoClient.GetKubernetesCluster(d.ClusterID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get cluster: %w", err)
+	}
+	if len(cluster.Instances) == 0 {
+		// Every attachment would look stale, which is far more likely to be a problem with the Civo API
+		return nil, nil, errors.New("the Civo API didn't list any of the cluster's instances")
+	}
+
+	live := map[string]struct{}{}
+	for _, instance := range cluster.Instances {
+		live[instance.ID] = struct{}{}
+	}
+
+	nodeInstances, err := d.csiNodeInstances(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	for instanceID := range nodeInstances {
+		live[instanceID] = struct{}{}
+	}
+
+	wantedBy, err := d.volumeAttachmentNodes(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stale := []civogo.Volume{}
+	for _, volume := range volumes {
+		if volume.ClusterID != d.ClusterID || volume.InstanceID == "" || volume.Status != "attached" {
+			continue
+		}
+		if _, ok := live[volume.InstanceID]; ok {
+			continue
+		}
+		stale = append(stale, volume)
+	}
+
+	return stale, wantedBy, nil
+}
+
+// volumeAttachmentNodes returns the node each volume's VolumeAttachment is for, by volume ID
+func (d *Driver) volumeAttachmentNodes(ctx context.Context) (map[string]string, error) {
+	attachments, err := d.KubeClient.StorageV1().VolumeAttachments().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list VolumeAttachments: %w", err)
+	}
+
+	pvs, err := d.KubeClient.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list PersistentVolumes: %w", err)
+	}
+
+	handles := map[string]string{}
+	for _, pv := range pvs.Items {
+		if pv.Spec.CSI != nil && pv.Spec.CSI.Driver == DriverName {
+			handles[pv.Name] = pv.Spec.CSI.VolumeHandle
+		}
+	}
+
+	nodes := map[string]string{}
+	for _, attachment := range attachments.Items {
+		if attachment.Spec.Attacher != DriverName || attachment.Spec.Source.PersistentVolumeName == nil {
+			continue
+		}
+		if handle, ok := handles[*attachment.Spec.Source.PersistentVolumeName]; ok {
+			nodes[handle] = attachment.Spec.NodeName
+		}
+	}
+
+	return nodes, nil
+}
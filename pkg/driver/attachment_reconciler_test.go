@@ -0,0 +1,125 @@
+package driver_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/civo/civo-csi/pkg/driver"
+	"github.com/civo/civogo"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestReconcileAttachments(t *testing.T) {
+	// newDriver returns a driver whose cluster has instance i-live, and a node i-new that the Civo API doesn't list
+	// yet, with volumes attached to each of them, to a deleted instance and another cluster's volume attached to
+	// a deleted instance
+	newDriver := func() (*driver.Driver, *civogo.FakeClient) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+		fc.Clusters = []civogo.KubernetesCluster{{
+			ID:        d.ClusterID,
+			Instances: []civogo.KubernetesInstance{{ID: "i-live"}},
+		}}
+		fc.Volumes = []civogo.Volume{
+			{ID: "vol-live", ClusterID: d.ClusterID, InstanceID: "i-live", Status: "attached"},
+			{ID: "vol-new", ClusterID: d.ClusterID, InstanceID: "i-new", Status: "attached"},
+			{ID: "vol-stale", ClusterID: d.ClusterID, InstanceID: "i-deleted", Status: "attached"},
+			{ID: "vol-available", ClusterID: d.ClusterID, Status: "available"},
+			{ID: "vol-other", ClusterID: "another-cluster", InstanceID: "i-deleted", Status: "attached"},
+		}
+		pvName := "pvc-stale"
+		d.KubeClient = fake.NewSimpleClientset(
+			&storagev1.CSINode{
+				ObjectMeta: metav1.ObjectMeta{Name: "node-new"},
+				Spec: storagev1.CSINodeSpec{
+					Drivers: []storagev1.CSINodeDriver{{Name: driver.DriverName, NodeID: "i-new"}},
+				},
+			},
+			&v1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{Name: pvName},
+				Spec: v1.PersistentVolumeSpec{
+					PersistentVolumeSource: v1.PersistentVolumeSource{
+						CSI: &v1.CSIPersistentVolumeSource{Driver: driver.DriverName, VolumeHandle: "vol-stale"},
+					},
+				},
+			},
+			&storagev1.VolumeAttachment{
+				ObjectMeta: metav1.ObjectMeta{Name: "csi-stale"},
+				Spec: storagev1.VolumeAttachmentSpec{
+					Attacher: driver.DriverName,
+					NodeName: "node-live",
+					Source:   storagev1.VolumeAttachmentSource{PersistentVolumeName: &pvName},
+				},
+			},
+		)
+		return d, fc
+	}
+
+	attachedTo := func(fc *civogo.FakeClient) map[string]string {
+		instances := map[string]string{}
+		for _, v := range fc.Volumes {
+			instances[v.ID] = v.InstanceID
+		}
+		return instances
+	}
+
+	t.Run("Detaches volumes from instances that are no longer in the cluster", func(t *testing.T) {
+		d, fc := newDriver()
+		recorder := record.NewFakeRecorder(10)
+		d.EventRecorder = recorder
+		t.Setenv("KUBE_NODE_NAME", "controller-node")
+
+		err := d.ReconcileAttachments(context.Background())
+		assert.Nil(t, err)
+
+		assert.Equal(t, map[string]string{
+			"vol-live":      "i-live",
+			"vol-new":       "i-new",
+			"vol-stale":     "",
+			"vol-available": "",
+			"vol-other":     "i-deleted",
+		}, attachedTo(fc))
+		assert.Len(t, recorder.Events, 1)
+		event := <-recorder.Events
+		assert.Contains(t, event, "StaleAttachmentDetached")
+		assert.Contains(t, event, "node-live")
+	})
+
+	t.Run("Doesn't detach volumes from instances outside the cluster that still exist", func(t *testing.T) {
+		d, fc := newDriver()
+		fc.Instances = []civogo.Instance{{ID: "i-deleted", Hostname: "debug"}}
+		recorder := record.NewFakeRecorder(10)
+		d.EventRecorder = recorder
+		t.Setenv("KUBE_NODE_NAME", "controller-node")
+
+		err := d.ReconcileAttachments(context.Background())
+		assert.Nil(t, err)
+
+		assert.Equal(t, "i-deleted", attachedTo(fc)["vol-stale"])
+		assert.Len(t, recorder.Events, 1)
+		assert.Contains(t, <-recorder.Events, "StaleAttachmentSkipped")
+	})
+
+	t.Run("Doesn't detach anything if the Civo API doesn't list the cluster's instances", func(t *testing.T) {
+		d, fc := newDriver()
+		fc.Clusters[0].Instances = nil
+
+		err := d.ReconcileAttachments(context.Background())
+		assert.NotNil(t, err)
+		assert.Equal(t, "i-deleted", attachedTo(fc)["vol-stale"])
+	})
+
+	t.Run("Fails without a Kubernetes API client", func(t *testing.T) {
+		d, fc := newDriver()
+		d.KubeClient = nil
+
+		err := d.ReconcileAttachments(context.Background())
+		assert.NotNil(t, err)
+		assert.Equal(t, "i-deleted", attachedTo(fc)["vol-stale"])
+	})
+}
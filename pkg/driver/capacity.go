@@ -0,0 +1,114 @@
+package driver
+
+import (
+	"fmt"
+
+	"github.com/civo/civogo"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultMinimumVolumeSizeGB is the smallest volume the driver creates, smaller requests are rounded up to it
+const DefaultMinimumVolumeSizeGB int64 = 1
+
+// DefaultMaximumVolumeSizeGB is the largest volume the driver creates or grows a volume to
+const DefaultMaximumVolumeSizeGB int64 = 16384
+
+// VolumeSizeGB returns the size in whole gigabytes of the volume to create (or grow to) for the capacity range.
+// The required bytes are rounded up to the next gigabyte and up to the minimum size, or if only a limit is given
+// the limit is rounded down to a gigabyte and the maximum size. It's OutOfRange if the volume would be bigger than
+// the limit, or the required size is bigger than the maximum.
+func VolumeSizeGB(capRange *csi.CapacityRange, minimumGB, maximumGB int64) (int64, error) {
+	requiredBytes := capRange.GetRequiredBytes()
+	limitBytes := capRange.GetLimitBytes()
+
+	if requiredBytes < 0 || limitBytes < 0 {
+		return 0, status.Errorf(codes.OutOfRange, "capacity range can't be negative, required %d bytes and limit %d bytes", requiredBytes, limitBytes)
+	}
+	if limitBytes > 0 && requiredBytes > limitBytes {
+		return 0, status.Errorf(codes.OutOfRange, "required capacity of %d bytes is more than the limit of %d bytes", requiredBytes, limitBytes)
+	}
+
+	var sizeGB int64
+	switch {
+	case requiredBytes > 0:
+		sizeGB = requiredBytes / BytesInGigabyte
+		if requiredBytes%BytesInGigabyte != 0 {
+			sizeGB++
+		}
+	case limitBytes > 0:
+		// Without a required size, use as much as the limit allows
+		sizeGB = limitBytes / BytesInGigabyte
+	default:
+		sizeGB = int64(DefaultVolumeSizeGB)
+	}
+
+	if sizeGB < minimumGB {
+		sizeGB = minimumGB
+	}
+	if limitBytes > 0 && sizeGB*BytesInGigabyte > limitBytes {
+		return 0, status.Errorf(codes.OutOfRange, "capacity limit of %d bytes is too small, volumes must be at least %dGB and a whole number of gigabytes", limitBytes, minimumGB)
+	}
+	if maximumGB > 0 && sizeGB > maximumGB {
+		if requiredBytes > 0 {
+			return 0, status.Errorf(codes.OutOfRange, "required capacity of %dGB is more than the maximum volume size of %dGB", sizeGB, maximumGB)
+		}
+		sizeGB = maximumGB
+	}
+
+	return sizeGB, nil
+}
+
+// volumeSizeGB returns the size of the volume for the capacity range, within the driver's volume size bounds
+func (d *Driver) volumeSizeGB(capRange *csi.CapacityRange) (int64, error) {
+	return VolumeSizeGB(capRange, d.MinimumVolumeSizeGB, d.MaximumVolumeSizeGB)
+}
+
+// availableCapacityGB returns how many gigabytes of volumes the quota has room for after the volumes being created,
+// which is none once the volume count limit is reached
+func availableCapacityGB(quota *civogo.Quota, reservedGB int64, reservedCount int) int64 {
+	if quota.DiskVolumeCountUsage+reservedCount >= quota.DiskVolumeCountLimit {
+		return 0
+	}
+
+	available := int64(quota.DiskGigabytesLimit-quota.DiskGigabytesUsage) - reservedGB
+	if available < 0 {
+		return 0
+	}
+	return available
+}
+
+// volumeTypeLister is implemented by Civo API clients that can list the volume types, which the fake client can't
+type volumeTypeLister interface {
+	ListVolumeTypes() ([]civogo.VolumeType, error)
+}
+
+// volumeType returns the Civo volume type for a StorageClass's parameters, checking it's enabled if the Civo API
+// client can list them
+func (d *Driver) volumeType(parameters map[string]string) (string, error) {
+	volumeType := parameters[ParameterVolumeType]
+	if volumeType == "" {
+		return d.ClusterVolumeType, nil
+	}
+
+	lister, ok := d.CivoClient.(volumeTypeLister)
+	if !ok {
+		return volumeType, nil
+	}
+
+	volumeTypes, err := lister.ListVolumeTypes()
+	if err != nil {
+		log.Warn().Err(err).Str("volume_type", volumeType).Msg("Unable to list volume types in Civo API, assuming it exists")
+		return volumeType, nil
+	}
+
+	for _, vt := range volumeTypes {
+		if vt.Name == volumeType && vt.Enabled {
+			return volumeType, nil
+		}
+	}
+
+	return "", fmt.Errorf("volume type %q isn't available", volumeType)
+}
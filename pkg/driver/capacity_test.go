@@ -0,0 +1,130 @@
+package driver_test
+
+import (
+	"testing"
+
+	"github.com/civo/civo-csi/pkg/driver"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestVolumeSizeGB(t *testing.T) {
+	gb := driver.BytesInGigabyte
+
+	tests := []struct {
+		name          string
+		capacityRange *csi.CapacityRange
+		minimumGB     int64
+		maximumGB     int64
+		expectedGB    int64
+		expectedCode  codes.Code
+	}{
+		{
+			name:          "Defaults the size without a capacity range",
+			capacityRange: nil,
+			minimumGB:     1,
+			maximumGB:     100,
+			expectedGB:    int64(driver.DefaultVolumeSizeGB),
+		},
+		{
+			name:          "Uses the required size",
+			capacityRange: &csi.CapacityRange{RequiredBytes: 20 * gb},
+			minimumGB:     1,
+			maximumGB:     100,
+			expectedGB:    20,
+		},
+		{
+			name:          "Rounds the required size up to a whole gigabyte",
+			capacityRange: &csi.CapacityRange{RequiredBytes: 20*gb + 1},
+			minimumGB:     1,
+			maximumGB:     100,
+			expectedGB:    21,
+		},
+		{
+			name:          "Rounds the required size up to the minimum",
+			capacityRange: &csi.CapacityRange{RequiredBytes: 1024 * 1024},
+			minimumGB:     5,
+			maximumGB:     100,
+			expectedGB:    5,
+		},
+		{
+			name:          "Uses the required size if it's within the limit",
+			capacityRange: &csi.CapacityRange{RequiredBytes: 20 * gb, LimitBytes: 30 * gb},
+			minimumGB:     1,
+			maximumGB:     100,
+			expectedGB:    20,
+		},
+		{
+			name:          "Rounds the limit down to a whole gigabyte without a required size",
+			capacityRange: &csi.CapacityRange{LimitBytes: 30*gb + 1},
+			minimumGB:     1,
+			maximumGB:     100,
+			expectedGB:    30,
+		},
+		{
+			name:          "Clamps the limit to the maximum without a required size",
+			capacityRange: &csi.CapacityRange{LimitBytes: 300 * gb},
+			minimumGB:     1,
+			maximumGB:     100,
+			expectedGB:    100,
+		},
+		{
+			name:          "Allows any size without a maximum",
+			capacityRange: &csi.CapacityRange{RequiredBytes: 300 * gb},
+			minimumGB:     1,
+			maximumGB:     0,
+			expectedGB:    300,
+		},
+		{
+			name:          "Rejects a required size bigger than the limit",
+			capacityRange: &csi.CapacityRange{RequiredBytes: 30 * gb, LimitBytes: 20 * gb},
+			minimumGB:     1,
+			maximumGB:     100,
+			expectedCode:  codes.OutOfRange,
+		},
+		{
+			name:          "Rejects a limit that rounding up would exceed",
+			capacityRange: &csi.CapacityRange{RequiredBytes: 20*gb + 1, LimitBytes: 20*gb + 2},
+			minimumGB:     1,
+			maximumGB:     100,
+			expectedCode:  codes.OutOfRange,
+		},
+		{
+			name:          "Rejects a limit smaller than the minimum",
+			capacityRange: &csi.CapacityRange{LimitBytes: 2 * gb},
+			minimumGB:     5,
+			maximumGB:     100,
+			expectedCode:  codes.OutOfRange,
+		},
+		{
+			name:          "Rejects a required size bigger than the maximum",
+			capacityRange: &csi.CapacityRange{RequiredBytes: 101 * gb},
+			minimumGB:     1,
+			maximumGB:     100,
+			expectedCode:  codes.OutOfRange,
+		},
+		{
+			name:          "Rejects a negative size",
+			capacityRange: &csi.CapacityRange{RequiredBytes: -1},
+			minimumGB:     1,
+			maximumGB:     100,
+			expectedCode:  codes.OutOfRange,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sizeGB, err := driver.VolumeSizeGB(tt.capacityRange, tt.minimumGB, tt.maximumGB)
+
+			if tt.expectedCode != codes.OK {
+				assert.Equal(t, tt.expectedCode, status.Code(err))
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expectedGB, sizeGB)
+		})
+	}
+}
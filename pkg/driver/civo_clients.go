@@ -0,0 +1,162 @@
+package driver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/civo/civogo"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The annotations external-provisioner records the secret a PV's volume was created with in, so it can be passed to
+// DeleteVolume
+const (
+	provisionerDeletionSecretNameAnnotation      = "volume.kubernetes.io/provisioner-deletion-secret-name"
+	provisionerDeletionSecretNamespaceAnnotation = "volume.kubernetes.io/provisioner-deletion-secret-namespace"
+)
+
+// DefaultCivoAccountIdleTimeout is how long the client for an API key from CSI secrets is kept after it was last used
+const DefaultCivoAccountIdleTimeout = time.Hour
+
+// CivoClientFactory creates a Civo API client for an API key, e.g. one passed to the driver in a CSI secret
+type CivoClientFactory func(apiKey, apiURL, region string) (civogo.Clienter, error)
+
+// civoAccount is a Civo API client and the quota reserved in its account by the volumes being created with it
+type civoAccount struct {
+	client            civogo.Clienter
+	quotaReservations *quotaReservations
+	// lastUsed is when a pooled account was last returned, guarded by civoAccounts.mu
+	lastUsed time.Time
+}
+
+// civoAccounts is a pool of the Civo accounts whose credentials have been passed to the driver in CSI secrets. An
+// account is evicted once it's been idle for the driver's CivoAccountIdleTimeout, so the clients for rotated or
+// removed keys aren't kept forever.
+type civoAccounts struct {
+	mu sync.Mutex
+	// accounts are keyed by a hash of the API URL and key, so the keys themselves aren't kept as map keys
+	accounts map[string]*civoAccount
+}
+
+// civoAccount returns the Civo account to use for a request with the given CSI secrets. That's the driver's own
+// account if there aren't any secrets, otherwise a pooled client for the secrets' SecretAPIKey (and SecretAPIURL, the
+// driver's API URL if it's not set).
+func (d *Driver) civoAccount(secrets map[string]string) (*civoAccount, error) {
+	if len(secrets) == 0 {
+		return &civoAccount{client: d.CivoClient, quotaReservations: &d.quotaReservations}, nil
+	}
+
+	apiKey := strings.TrimSpace(secrets[SecretAPIKey])
+	if apiKey == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "secrets must have a Civo API key in %s", SecretAPIKey)
+	}
+	apiURL := strings.TrimSpace(secrets[SecretAPIURL])
+	if apiURL == "" {
+		apiURL = d.APIURL
+	}
+
+	hash := sha256.Sum256([]byte(apiURL + "\n" + apiKey))
+	key := hex.EncodeToString(hash[:])
+
+	d.civoAccounts.mu.Lock()
+	defer d.civoAccounts.mu.Unlock()
+
+	now := time.Now()
+	d.evictIdleCivoAccountsLocked(now)
+
+	if account, ok := d.civoAccounts.accounts[key]; ok {
+		account.lastUsed = now
+		return account, nil
+	}
+
+	client, err := d.NewCivoClient(apiKey, apiURL, d.Region)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "cannot create a Civo API client from the secrets: %s", err)
+	}
+
+	if d.civoAccounts.accounts == nil {
+		d.civoAccounts.accounts = map[string]*civoAccount{}
+	}
+	account := &civoAccount{client: client, quotaReservations: &quotaReservations{}, lastUsed: now}
+	d.civoAccounts.accounts[key] = account
+	log.Info().Str("api_url", apiURL).Str("credentials", key[:12]).Msg("Created a Civo API client for credentials from secrets")
+
+	return account, nil
+}
+
+// evictIdleCivoAccountsLocked removes the pooled accounts that haven't been used for the CivoAccountIdleTimeout, unless
+// they have volumes being created whose quota is still reserved
+func (d *Driver) evictIdleCivoAccountsLocked(now time.Time) {
+	for key, account := range d.civoAccounts.accounts {
+		if now.Sub(account.lastUsed) < d.CivoAccountIdleTimeout {
+			continue
+		}
+		if _, pending := account.quotaReservations.total(); pending > 0 {
+			continue
+		}
+		delete(d.civoAccounts.accounts, key)
+		log.Info().Str("credentials", key[:12]).Msg("Removed the idle Civo API client for credentials from secrets")
+	}
+}
+
+// persistentVolumeSecretRef returns the secret with the Civo API key for the PV's volume, or nil if it uses the
+// driver's own. That's the secret it's attached with, or failing that, resized or created with.
+func persistentVolumeSecretRef(pv *v1.PersistentVolume) *v1.SecretReference {
+	if ref := pv.Spec.CSI.ControllerPublishSecretRef; ref != nil {
+		return ref
+	}
+	if ref := pv.Spec.CSI.ControllerExpandSecretRef; ref != nil {
+		return ref
+	}
+
+	name := pv.Annotations[provisionerDeletionSecretNameAnnotation]
+	namespace := pv.Annotations[provisionerDeletionSecretNamespaceAnnotation]
+	if name != "" && namespace != "" {
+		return &v1.SecretReference{Name: name, Namespace: namespace}
+	}
+	return nil
+}
+
+// secretRefKey identifies a secret's Civo account in maps, it's "" for the driver's own account
+func secretRefKey(ref *v1.SecretReference) string {
+	if ref == nil {
+		return ""
+	}
+	return ref.Namespace + "/" + ref.Name
+}
+
+// secretCivoAccount returns the Civo account for the API key in the referenced secret, for work that isn't passed
+// the secrets by a sidecar, or the driver's own account if ref is nil
+func (d *Driver) secretCivoAccount(ctx context.Context, ref *v1.SecretReference) (*civoAccount, error) {
+	if ref == nil {
+		return d.civoAccount(nil)
+	}
+
+	secret, err := d.KubeClient.CoreV1().Secrets(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get secret %s/%s: %w", ref.Namespace, ref.Name, err)
+	}
+
+	secrets := map[string]string{}
+	for key, value := range secret.Data {
+		secrets[key] = string(value)
+	}
+	if len(secrets) == 0 {
+		return nil, fmt.Errorf("secret %s/%s is empty", ref.Namespace, ref.Name)
+	}
+
+	account, err := d.civoAccount(secrets)
+	if err != nil {
+		return nil, fmt.Errorf("secret %s/%s: %s", ref.Namespace, ref.Name, status.Convert(err).Message())
+	}
+	return account, nil
+}
@@ -0,0 +1,153 @@
+package driver_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/civo/civo-csi/pkg/driver"
+	"github.com/civo/civogo"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCivoAccountSecrets(t *testing.T) {
+	// newDriver returns a driver whose factory creates a fake client per API key, and those clients by key
+	newDriver := func() (*driver.Driver, *civogo.FakeClient, map[string]*civogo.FakeClient) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+		d.KubeClient = fake.NewSimpleClientset()
+		fc.Clusters = []civogo.KubernetesCluster{{
+			ID:        d.ClusterID,
+			Instances: []civogo.KubernetesInstance{{ID: "i-12345678"}},
+		}}
+
+		clients := map[string]*civogo.FakeClient{}
+		d.NewCivoClient = func(apiKey, apiURL, region string) (civogo.Clienter, error) {
+			client, _ := civogo.NewFakeClient()
+			clients[apiKey] = client
+			return client, nil
+		}
+		return d, fc, clients
+	}
+
+	secrets := map[string]string{driver.SecretAPIKey: "team-a-key"}
+
+	t.Run("Manages volumes in the secrets' account", func(t *testing.T) {
+		d, fc, clients := newDriver()
+
+		req := minimalVolumeRequest("pvc-1234")
+		req.Secrets = secrets
+		resp, err := d.CreateVolume(context.Background(), req)
+		assert.Nil(t, err)
+		assert.Empty(t, fc.Volumes)
+		assert.Len(t, clients, 1)
+		teamA := clients["team-a-key"]
+		assert.Len(t, teamA.Volumes, 1)
+		volumeID := resp.Volume.VolumeId
+
+		_, err = d.ControllerPublishVolume(context.Background(), &csi.ControllerPublishVolumeRequest{
+			VolumeId:         volumeID,
+			NodeId:           "i-12345678",
+			VolumeCapability: req.VolumeCapabilities[0],
+			Secrets:          secrets,
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, "i-12345678", teamA.Volumes[0].InstanceID)
+
+		_, err = d.ControllerUnpublishVolume(context.Background(), &csi.ControllerUnpublishVolumeRequest{
+			VolumeId: volumeID,
+			NodeId:   "i-12345678",
+			Secrets:  secrets,
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, "", teamA.Volumes[0].InstanceID)
+
+		_, err = d.ControllerExpandVolume(context.Background(), &csi.ControllerExpandVolumeRequest{
+			VolumeId:      volumeID,
+			CapacityRange: &csi.CapacityRange{RequiredBytes: 20 * driver.BytesInGigabyte},
+			Secrets:       secrets,
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, 20, teamA.Volumes[0].SizeGigabytes)
+
+		_, err = d.DeleteVolume(context.Background(), &csi.DeleteVolumeRequest{VolumeId: volumeID, Secrets: secrets})
+		assert.Nil(t, err)
+		assert.Empty(t, teamA.Volumes)
+
+		// Every request used the same pooled client
+		assert.Len(t, clients, 1)
+	})
+
+	t.Run("Uses a client per API key", func(t *testing.T) {
+		d, fc, clients := newDriver()
+
+		for name, secrets := range map[string]map[string]string{
+			"pvc-1": nil,
+			"pvc-2": {driver.SecretAPIKey: "team-b-key"},
+			"pvc-3": secrets,
+		} {
+			req := minimalVolumeRequest(name)
+			req.Secrets = secrets
+			_, err := d.CreateVolume(context.Background(), req)
+			assert.Nil(t, err)
+		}
+
+		assert.Len(t, fc.Volumes, 1)
+		assert.Len(t, clients["team-a-key"].Volumes, 1)
+		assert.Len(t, clients["team-b-key"].Volumes, 1)
+	})
+
+	t.Run("Checks the quota of the secrets' account", func(t *testing.T) {
+		d, _, _ := newDriver()
+		d.NewCivoClient = func(apiKey, apiURL, region string) (civogo.Clienter, error) {
+			client, _ := civogo.NewFakeClient()
+			client.Quota.DiskGigabytesLimit = 5
+			return client, nil
+		}
+
+		req := minimalVolumeRequest("pvc-1234")
+		req.Secrets = secrets
+		_, err := d.CreateVolume(context.Background(), req)
+		assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	})
+
+	t.Run("Removes idle clients", func(t *testing.T) {
+		d, _, _ := newDriver()
+		created := 0
+		d.NewCivoClient = func(apiKey, apiURL, region string) (civogo.Clienter, error) {
+			created++
+			client, _ := civogo.NewFakeClient()
+			return client, nil
+		}
+
+		for _, name := range []string{"pvc-1", "pvc-2"} {
+			req := minimalVolumeRequest(name)
+			req.Secrets = secrets
+			_, err := d.CreateVolume(context.Background(), req)
+			assert.Nil(t, err)
+		}
+		assert.Equal(t, 1, created)
+
+		d.CivoAccountIdleTimeout = 0
+		req := minimalVolumeRequest("pvc-3")
+		req.Secrets = secrets
+		_, err := d.CreateVolume(context.Background(), req)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, created)
+	})
+
+	t.Run("Rejects secrets without an API key", func(t *testing.T) {
+		d, _, _ := newDriver()
+
+		req := minimalVolumeRequest("pvc-1234")
+		req.Secrets = map[string]string{driver.SecretAPIURL: "https://api.civo.com"}
+		_, err := d.CreateVolume(context.Background(), req)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+		_, err = d.DeleteVolume(context.Background(), &csi.DeleteVolumeRequest{VolumeId: "vol-1", Secrets: req.Secrets})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
@@ -4,14 +4,19 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/civo/civogo"
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/protobuf/ptypes/wrappers"
 	"github.com/rs/zerolog/log"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // BytesInGigabyte describes how many bytes are in a gigabyte
@@ -44,6 +49,12 @@ func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 		return nil, status.Error(codes.InvalidArgument, "CreateVolume Volume capabilities must be provided")
 	}
 
+	// The Civo API can't restore a snapshot or clone a volume yet, so creating an empty volume would hand the
+	// workload a volume without the data it asked for
+	if req.GetVolumeContentSource() != nil {
+		return nil, status.Error(codes.InvalidArgument, "CreateVolume unsupported volume content source")
+	}
+
 	log.Info().Str("name", req.Name).Interface("capabilities", req.VolumeCapabilities).Msg("Creating volume")
 
 	// Check capabilities (cheap, no API call — kept outside singleflight so
@@ -55,23 +66,52 @@ func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 		if _, ok := cap.GetAccessType().(*csi.VolumeCapability_Block); ok {
 			return nil, status.Error(codes.InvalidArgument, "CreateVolume block types aren't supported, only mount types")
 		}
+		if err := validateMountFlags(cap.GetMount().GetMountFlags()); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "CreateVolume %s", err)
+		}
+	}
+
+	if err := d.checkAccessibilityRequirements(req.GetAccessibilityRequirements()); err != nil {
+		return nil, err
+	}
+
+	volumeType, err := d.volumeType(req.GetParameters())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "CreateVolume parameter %s is invalid: %s", ParameterVolumeType, err)
+	}
+
+	if _, _, err := parseDeletionPolicy(req.GetParameters()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "CreateVolume parameter %s", err)
+	}
+
+	for _, param := range []string{ParameterFilesystemCheck, ParameterDetachUnusedToResize} {
+		if value, ok := req.GetParameters()[param]; ok {
+			if _, err := strconv.ParseBool(value); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "CreateVolume parameter %s must be true or false, not %q", param, value)
+			}
+		}
 	}
 
 	// Determine required size.
-	bytes, err := getVolSizeInBytes(req.GetCapacityRange())
+	desiredSize, err := d.volumeSizeGB(req.GetCapacityRange())
 	if err != nil {
 		return nil, err
 	}
 
-	desiredSize := bytes / BytesInGigabyte
-	if (bytes % BytesInGigabyte) != 0 {
-		desiredSize++
+	log.Debug().Int64("size_gb", desiredSize).Msg("Volume size determined")
+
+	name, err := d.volumeName(req)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "CreateVolume can't name the volume: %s", err)
 	}
 
-	log.Debug().Int64("size_gb", desiredSize).Msg("Volume size determined")
+	account, err := d.civoAccount(req.GetSecrets())
+	if err != nil {
+		return nil, err
+	}
 
 	v, err, shared := d.volumeCreateGroup.Do(req.Name, func() (interface{}, error) {
-		return d.createVolumeUnsynced(ctx, req, desiredSize)
+		return d.createVolumeUnsynced(ctx, account, req, name, desiredSize, volumeType)
 	})
 	if err != nil {
 		return nil, err
@@ -84,10 +124,11 @@ func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 
 // createVolumeUnsynced is the side-effectful body of CreateVolume. It must
 // only be invoked through d.volumeCreateGroup so concurrent retries for the
-// same req.Name are coalesced.
-func (d *Driver) createVolumeUnsynced(_ context.Context, req *csi.CreateVolumeRequest, desiredSize int64) (*csi.CreateVolumeResponse, error) {
+// same req.Name are coalesced. name is the Civo volume's name, created in the
+// account's Civo account.
+func (d *Driver) createVolumeUnsynced(_ context.Context, account *civoAccount, req *csi.CreateVolumeRequest, name string, desiredSize int64, volumeType string) (*csi.CreateVolumeResponse, error) {
 	log.Debug().Msg("Listing current volumes in Civo API")
-	if resp, found, err := d.lookupExistingByName(req.Name, desiredSize); err != nil {
+	if resp, found, err := d.lookupExistingByName(account.client, req, name, desiredSize); err != nil {
 		log.Error().Err(err).Msg("Unable to list volumes in Civo API")
 		return nil, err
 	} else if found {
@@ -113,33 +154,35 @@ func (d *Driver) createVolumeUnsynced(_ context.Context, req *csi.CreateVolumeRe
 	log.Debug().Msg("Volume doesn't currently exist, will need creating")
 
 	log.Debug().Msg("Requesting available capacity in client's quota from the Civo API")
-	quota, err := d.CivoClient.GetQuota()
+	quota, err := account.client.GetQuota()
 	if err != nil {
 		log.Error().Err(err).Msg("Unable to get quota from Civo API")
 		return nil, err
 	}
-	availableSize := int64(quota.DiskGigabytesLimit - quota.DiskGigabytesUsage)
-	if availableSize < desiredSize {
-		log.Error().Msg("Requested volume would exceed storage quota available")
-		return nil, status.Errorf(codes.OutOfRange, "Requested volume would exceed volume space quota by %d GB", desiredSize-availableSize)
-	} else if quota.DiskVolumeCountUsage >= quota.DiskVolumeCountLimit {
-		log.Error().Msg("Requested volume would exceed volume quota available")
-		return nil, status.Errorf(codes.OutOfRange, "Requested volume would exceed volume count limit quota of %d", quota.DiskVolumeCountLimit)
+	// Hold the volume's share of the quota until it's been created, so other volumes being created at the same time
+	// can't use it too
+	release, err := account.quotaReservations.reserve(name, desiredSize, quota)
+	if err != nil {
+		log.Error().Err(err).Msg("Requested volume would exceed quota available")
+		return nil, err
 	}
 
 	log.Debug().Int("disk_gb_limit", quota.DiskGigabytesLimit).Int("disk_gb_usage", quota.DiskGigabytesUsage).Msg("Quota has sufficient capacity remaining")
 
 	v := &civogo.VolumeConfig{
-		Name:          req.Name,
+		Name:          name,
 		Region:        d.Region,
 		Namespace:     d.Namespace,
 		ClusterID:     d.ClusterID,
 		SizeGigabytes: int(desiredSize),
-		VolumeType:    d.ClusterVolumeType,
+		VolumeType:    volumeType,
 		// SnapshotID: snapshotID, // TODO: Uncomment after client implementation is complete.
 	}
 	log.Debug().Msg("Creating volume in Civo API")
-	result, err := d.CivoClient.NewVolume(v)
+	result, err := account.client.NewVolume(v)
+	// Once the volume's been created, the Civo API's quota usage counts it, so it mustn't be reserved as well while
+	// it becomes available
+	release()
 	if err != nil {
 		// If the Civo API rejects the create because a sibling request with
 		// the same name already won the race server-side (api-go #243), this
@@ -147,7 +190,7 @@ func (d *Driver) createVolumeUnsynced(_ context.Context, req *csi.CreateVolumeRe
 		// existing volume up by name and return it as a success.
 		if errors.Is(err, civogo.DatabaseVolumeDuplicateNameError) {
 			log.Info().Str("name", req.Name).Msg("Civo API reported a duplicate name; resolving idempotently")
-			if resp, found, lookupErr := d.lookupExistingByName(req.Name, desiredSize); lookupErr != nil {
+			if resp, found, lookupErr := d.lookupExistingByName(account.client, req, name, desiredSize); lookupErr != nil {
 				log.Warn().Err(lookupErr).Str("name", req.Name).Msg("Idempotent lookup after duplicate-name failed; returning original error")
 			} else if found {
 				return resp, nil
@@ -159,16 +202,16 @@ func (d *Driver) createVolumeUnsynced(_ context.Context, req *csi.CreateVolumeRe
 		return nil, err
 	}
 
-	log.Info().Str("volume_id", result.ID).Msg("Volume created in Civo API")
+	log.Info().Str("volume_id", result.ID).Str("volume_name", name).Msg("Volume created in Civo API")
 
-	volume, err := d.CivoClient.GetVolume(result.ID)
+	volume, err := account.client.GetVolume(result.ID)
 	if err != nil {
 		log.Error().Err(err).Msg("Unable to get volume updates in Civo API")
 		return nil, err
 	}
 
 	log.Debug().Str("volume_id", result.ID).Msg("Waiting for volume to become available in Civo API")
-	available, err := d.waitForVolumeStatus(volume, "available", CivoVolumeAvailableRetries)
+	available, err := d.waitForVolumeStatus(account.client, volume, "available", CivoVolumeAvailableRetries)
 	if err != nil {
 		log.Error().Err(err).Msg("Volume availability never completed successfully in Civo API")
 		return nil, err
@@ -177,8 +220,10 @@ func (d *Driver) createVolumeUnsynced(_ context.Context, req *csi.CreateVolumeRe
 	if available {
 		return &csi.CreateVolumeResponse{
 			Volume: &csi.Volume{
-				VolumeId:      volume.ID,
-				CapacityBytes: int64(v.SizeGigabytes) * BytesInGigabyte,
+				VolumeId:           volume.ID,
+				CapacityBytes:      int64(v.SizeGigabytes) * BytesInGigabyte,
+				VolumeContext:      volumeContext(req),
+				AccessibleTopology: d.volumeTopology(),
 			},
 		}, nil
 	}
@@ -187,17 +232,40 @@ func (d *Driver) createVolumeUnsynced(_ context.Context, req *csi.CreateVolumeRe
 	return nil, status.Errorf(codes.Unavailable, "Civo Volume %q is not \"available\", state currently is %q", volume.ID, volume.Status)
 }
 
+// volumeContext returns the VolumeContext for a volume created by the request, recording anything the node needs
+// to know when staging it
+func volumeContext(req *csi.CreateVolumeRequest) map[string]string {
+	volCtx := map[string]string{}
+
+	if fsCheck, _ := strconv.ParseBool(req.GetParameters()[ParameterFilesystemCheck]); fsCheck {
+		volCtx[VolumeContextFilesystemCheck] = "true"
+	}
+
+	if detachUnused, _ := strconv.ParseBool(req.GetParameters()[ParameterDetachUnusedToResize]); detachUnused {
+		volCtx[VolumeContextDetachUnusedToResize] = "true"
+	}
+
+	if policy, ok := req.GetParameters()[ParameterDeletionPolicy]; ok {
+		volCtx[VolumeContextDeletionPolicy] = policy
+	}
+	if days, ok := req.GetParameters()[ParameterSoftDeleteDays]; ok {
+		volCtx[VolumeContextSoftDeleteDays] = days
+	}
+
+	return volCtx
+}
+
 // resolveExistingVolume handles the "volume already exists with this name"
 // case found while listing — returns the existing volume as a successful
 // CreateVolumeResponse if the requested size matches and the volume is
 // available, or an appropriate error otherwise.
-func (d *Driver) resolveExistingVolume(v civogo.Volume, desiredSize int64) (*csi.CreateVolumeResponse, error) {
+func (d *Driver) resolveExistingVolume(client civogo.Clienter, req *csi.CreateVolumeRequest, v civogo.Volume, desiredSize int64) (*csi.CreateVolumeResponse, error) {
 	log.Debug().Str("volume_id", v.ID).Msg("Volume already exists")
 	if v.SizeGigabytes != int(desiredSize) {
 		return nil, status.Error(codes.AlreadyExists, "Volume already exists with a differnt size")
 	}
 
-	available, err := d.waitForVolumeStatus(&v, "available", CivoVolumeAvailableRetries)
+	available, err := d.waitForVolumeStatus(client, &v, "available", CivoVolumeAvailableRetries)
 	if err != nil {
 		log.Error().Err(err).Msg("Unable to wait for volume availability in Civo API")
 		return nil, err
@@ -206,8 +274,10 @@ func (d *Driver) resolveExistingVolume(v civogo.Volume, desiredSize int64) (*csi
 	if available {
 		return &csi.CreateVolumeResponse{
 			Volume: &csi.Volume{
-				VolumeId:      v.ID,
-				CapacityBytes: int64(v.SizeGigabytes) * BytesInGigabyte,
+				VolumeId:           v.ID,
+				CapacityBytes:      int64(v.SizeGigabytes) * BytesInGigabyte,
+				VolumeContext:      volumeContext(req),
+				AccessibleTopology: d.volumeTopology(),
 			},
 		}, nil
 	}
@@ -216,8 +286,9 @@ func (d *Driver) resolveExistingVolume(v civogo.Volume, desiredSize int64) (*csi
 	return nil, status.Errorf(codes.Unavailable, "Volume isn't available to be attached, state is currently %s", v.Status)
 }
 
-// lookupExistingByName lists volumes and, if one matches the given name,
-// returns it as a CreateVolumeResponse. The "found" return distinguishes
+// lookupExistingByName lists volumes and, if one is called name or the
+// request's name (as it would be if it was created before the volume name
+// template was set), returns it as a CreateVolumeResponse. The "found" return distinguishes
 // "volume with this name exists" (true, resp may carry a resolve error)
 // from "no such volume" (false, resp == nil) so callers can act on each
 // case explicitly:
@@ -228,14 +299,14 @@ func (d *Driver) resolveExistingVolume(v civogo.Volume, desiredSize int64) (*csi
 //     couldn't recover idempotently; return the original error".
 //
 // err is non-nil only when the underlying ListVolumes call itself failed.
-func (d *Driver) lookupExistingByName(name string, desiredSize int64) (*csi.CreateVolumeResponse, bool, error) {
-	volumes, err := d.CivoClient.ListVolumes()
+func (d *Driver) lookupExistingByName(client civogo.Clienter, req *csi.CreateVolumeRequest, name string, desiredSize int64) (*csi.CreateVolumeResponse, bool, error) {
+	volumes, err := client.ListVolumes()
 	if err != nil {
 		return nil, false, fmt.Errorf("list volumes for lookup: %w", err)
 	}
 	for _, v := range volumes {
-		if v.Name == name {
-			resp, rerr := d.resolveExistingVolume(v, desiredSize)
+		if v.Name == name || v.Name == req.Name {
+			resp, rerr := d.resolveExistingVolume(client, req, v, desiredSize)
 			return resp, true, rerr
 		}
 	}
@@ -244,7 +315,7 @@ func (d *Driver) lookupExistingByName(name string, desiredSize int64) (*csi.Crea
 
 // waitForVolumeAvailable will just sleep/loop waiting for Civo's API to report it's available, or hit a defined
 // number of retries
-func (d *Driver) waitForVolumeStatus(vol *civogo.Volume, desiredStatus string, retries int) (bool, error) {
+func (d *Driver) waitForVolumeStatus(client civogo.Clienter, vol *civogo.Volume, desiredStatus string, retries int) (bool, error) {
 	log.Info().Str("volume_id", vol.ID).Str("desired_state", desiredStatus).Msg("Waiting for Volume to entered desired state")
 	var v *civogo.Volume
 	var err error
@@ -256,7 +327,7 @@ func (d *Driver) waitForVolumeStatus(vol *civogo.Volume, desiredStatus string, r
 	for i := 0; i < retries; i++ {
 		time.Sleep(5 * time.Second)
 
-		v, err = d.CivoClient.GetVolume(vol.ID)
+		v, err = client.GetVolume(vol.ID)
 		if err != nil {
 			log.Error().Err(err).Msg("Unable to get volume updates in Civo API")
 			return false, err
@@ -277,8 +348,26 @@ func (d *Driver) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequest)
 		return nil, status.Error(codes.InvalidArgument, "must provide a VolumeId to DeleteVolume")
 	}
 
+	account, err := d.civoAccount(req.GetSecrets())
+	if err != nil {
+		return nil, err
+	}
+
+	// The deletion policy is on the volume's PV, so without a Kubernetes API client a protected volume can't be told
+	// apart from one that can be deleted
+	if d.KubeClient == nil {
+		return nil, status.Error(codes.Unavailable, "cannot check the volume's deletion policy without a Kubernetes API client")
+	}
+	deleteVolume, err := d.applyDeletionPolicy(ctx, account.client, req.VolumeId)
+	if err != nil {
+		return nil, err
+	}
+	if !deleteVolume {
+		return &csi.DeleteVolumeResponse{}, nil
+	}
+
 	log.Debug().Msg("Deleting volume in Civo API")
-	_, err := d.CivoClient.DeleteVolume(req.VolumeId)
+	_, err = account.client.DeleteVolume(req.VolumeId)
 	if err != nil {
 		if strings.Contains(err.Error(), "DatabaseVolumeNotFoundError") {
 			log.Info().Str("volume_id", req.VolumeId).Msg("Volume already deleted from Civo API")
@@ -296,7 +385,7 @@ func (d *Driver) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequest)
 
 // ControllerPublishVolume is used to mount an underlying volume to required k3s node
 func (d *Driver) ControllerPublishVolume(ctx context.Context, req *csi.ControllerPublishVolumeRequest) (*csi.ControllerPublishVolumeResponse, error) {
-	log.Info().Str("volume_id", req.VolumeId).Str("node_id", req.NodeId).Msg("Request: ControllerPublishVolume")
+	log.Info().Str("volume_id", req.VolumeId).Str("node_id", req.NodeId).Bool("readonly", req.Readonly).Msg("Request: ControllerPublishVolume")
 
 	if req.VolumeCapability == nil {
 		return nil, status.Error(codes.InvalidArgument, "must provide a VolumeCapability to ControllerPublishVolume")
@@ -310,6 +399,11 @@ func (d *Driver) ControllerPublishVolume(ctx context.Context, req *csi.Controlle
 		return nil, status.Error(codes.InvalidArgument, "must provide a NodeId to ControllerPublishVolume")
 	}
 
+	account, err := d.civoAccount(req.GetSecrets())
+	if err != nil {
+		return nil, err
+	}
+
 	log.Debug().Msg("Check if Node exits")
 	cluster, err := d.CivoClient.GetKubernetesCluster(d.ClusterID)
 	if err != nil {
@@ -327,17 +421,47 @@ func (d *Driver) ControllerPublishVolume(ctx context.Context, req *csi.Controlle
 	}
 
 	log.Debug().Msg("Finding volume in Civo API")
-	volume, err := d.CivoClient.GetVolume(req.VolumeId)
+	volume, err := account.client.GetVolume(req.VolumeId)
 	if err != nil {
 		log.Error().Err(err).Msg("Unable to find volume for publishing in Civo API")
 		return nil, err
 	}
 	log.Debug().Str("volume_id", volume.ID).Msg("Volume found for publishing in Civo API")
 
+	if req.GetVolumeContext()[VolumeContextAdopt] == "true" {
+		if err := d.checkAdoptable(volume, cluster); err != nil {
+			log.Error().Err(err).Str("volume_id", volume.ID).Msg("Volume can't be adopted by the cluster")
+			d.recordVolumeEvent(ctx, volume.ID, v1.EventTypeWarning, "AdoptionRefused", "Refusing to attach existing volume %s: %s", volume.ID, status.Convert(err).Message())
+			return nil, err
+		}
+		// The Civo API can't update a volume, so it can't be tagged with the cluster and namespace
+		log.Info().Str("volume_id", volume.ID).Str("cluster_id", volume.ClusterID).Msg("Existing volume can be adopted by the cluster")
+	}
+
 	// Check if the volume is already attached to the requested node
 	if volume.InstanceID == req.NodeId && volume.Status == "attached" {
 		log.Info().Str("volume_id", volume.ID).Str("instance_id", req.NodeId).Msg("Volume is already attached to the requested instance")
-		return &csi.ControllerPublishVolumeResponse{}, nil
+		return &csi.ControllerPublishVolumeResponse{PublishContext: publishContext(req)}, nil
+	}
+
+	// If the volume is attached to an instance that's gone or out of service, it can be detached without the
+	// instance's cooperation. Otherwise it's not available, so we can't attach it.
+	if volume.Status != "available" && volume.InstanceID != req.NodeId && volume.InstanceID != "" {
+		reason, err := d.forceDetachReason(ctx, volume.InstanceID)
+		if err != nil {
+			log.Warn().Err(err).Str("volume_id", volume.ID).Str("instance_id", volume.InstanceID).Msg("Unable to tell if volume can be force detached")
+		}
+		if reason != "" {
+			if err := d.forceDetach(ctx, account.client, volume, reason); err != nil {
+				return nil, err
+			}
+
+			volume, err = account.client.GetVolume(req.VolumeId)
+			if err != nil {
+				log.Error().Err(err).Msg("Unable to find volume for publishing in Civo API")
+				return nil, err
+			}
+		}
 	}
 
 	// if the volume is not available, we can't attach it, so error out
@@ -368,7 +492,7 @@ func (d *Driver) ControllerPublishVolume(ctx context.Context, req *csi.Controlle
 			Region:     d.Region,
 		}
 
-		_, err = d.CivoClient.AttachVolume(req.VolumeId, volConfig)
+		_, err = account.client.AttachVolume(req.VolumeId, volConfig)
 		if err != nil {
 			log.Error().Err(err).Msg("Unable to attach volume in Civo API")
 			return nil, err
@@ -379,7 +503,7 @@ func (d *Driver) ControllerPublishVolume(ctx context.Context, req *csi.Controlle
 	time.Sleep(5 * time.Second)
 	// refetch the volume
 	log.Info().Str("volume_id", volume.ID).Msg("Fetching volume again to check status after attaching")
-	volume, err = d.CivoClient.GetVolume(req.VolumeId)
+	volume, err = account.client.GetVolume(req.VolumeId)
 	if err != nil {
 		log.Error().Err(err).Msg("Unable to fetch volume from Civo API")
 		return nil, err
@@ -395,7 +519,28 @@ func (d *Driver) ControllerPublishVolume(ctx context.Context, req *csi.Controlle
 	}
 
 	log.Debug().Str("volume_id", volume.ID).Msg("Volume successfully attached in Civo API")
-	return &csi.ControllerPublishVolumeResponse{}, nil
+	return &csi.ControllerPublishVolumeResponse{PublishContext: publishContext(req)}, nil
+}
+
+// publishContext records how the volume was attached, for the node's stage and publish calls. Civo volumes can't
+// be attached read-only, so the node has to enforce it.
+func publishContext(req *csi.ControllerPublishVolumeRequest) map[string]string {
+	if !req.Readonly && !readOnlyAccessMode(req.VolumeCapability) {
+		return nil
+	}
+
+	return map[string]string{
+		PublishContextReadOnly: "true",
+	}
+}
+
+// readOnlyAccessMode returns true if the capability's access mode only allows reading from the volume
+func readOnlyAccessMode(cap *csi.VolumeCapability) bool {
+	switch cap.GetAccessMode().GetMode() {
+	case csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY, csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY:
+		return true
+	}
+	return false
 }
 
 // ControllerUnpublishVolume detaches the volume from the k3s node it was connected
@@ -406,8 +551,13 @@ func (d *Driver) ControllerUnpublishVolume(ctx context.Context, req *csi.Control
 		return nil, status.Error(codes.InvalidArgument, "must provide a VolumeId to ControllerUnpublishVolume")
 	}
 
+	account, err := d.civoAccount(req.GetSecrets())
+	if err != nil {
+		return nil, err
+	}
+
 	log.Debug().Msg("Finding volume in Civo API")
-	volume, err := d.CivoClient.GetVolume(req.VolumeId)
+	volume, err := account.client.GetVolume(req.VolumeId)
 	if err != nil {
 		if strings.Contains(err.Error(), "DatabaseVolumeNotFoundError") || strings.Contains(err.Error(), "ZeroMatchesError") {
 			log.Info().Str("volume_id", req.VolumeId).Msg("Volume already deleted from Civo API, pretend it's unmounted")
@@ -443,7 +593,7 @@ func (d *Driver) ControllerUnpublishVolume(ctx context.Context, req *csi.Control
 			Str("status", volume.Status).
 			Msg("Requesting volume to be detached")
 
-		_, err = d.CivoClient.DetachVolume(req.VolumeId)
+		_, err = account.client.DetachVolume(req.VolumeId)
 		if err != nil {
 			log.Error().Err(err).Msg("Unable to detach volume in Civo API")
 			return nil, err
@@ -454,7 +604,7 @@ func (d *Driver) ControllerUnpublishVolume(ctx context.Context, req *csi.Control
 
 	// Fetch the new state after 5 seconds
 	time.Sleep(5 * time.Second)
-	volume, err = d.CivoClient.GetVolume(req.VolumeId)
+	volume, err = account.client.GetVolume(req.VolumeId)
 	if err != nil {
 		log.Error().Err(err).Msg("Unable to find volume for unpublishing in Civo API")
 		return nil, err
@@ -480,8 +630,13 @@ func (d *Driver) ControllerExpandVolume(ctx context.Context, req *csi.Controller
 		return nil, status.Error(codes.InvalidArgument, "must provide a VolumeId to ControllerExpandVolume")
 	}
 
+	account, err := d.civoAccount(req.GetSecrets())
+	if err != nil {
+		return nil, err
+	}
+
 	// Get the volume from the Civo API
-	volume, err := d.CivoClient.GetVolume(volID)
+	volume, err := account.client.GetVolume(volID)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "ControllerExpandVolume could not retrieve existing volume: %v", err)
 	}
@@ -489,14 +644,10 @@ func (d *Driver) ControllerExpandVolume(ctx context.Context, req *csi.Controller
 	if req.CapacityRange == nil {
 		return nil, status.Error(codes.InvalidArgument, "must provide a capacity range to ControllerExpandVolume")
 	}
-	bytes, err := getVolSizeInBytes(req.GetCapacityRange())
+	desiredSize, err := d.volumeSizeGB(req.GetCapacityRange())
 	if err != nil {
 		return nil, err
 	}
-	desiredSize := bytes / BytesInGigabyte
-	if (bytes % BytesInGigabyte) != 0 {
-		desiredSize++
-	}
 	log.Debug().Int("current_size", volume.SizeGigabytes).Int64("desired_size", desiredSize).Str("state", volume.Status).Msg("Volume found")
 
 	if volume.Status == "resizing" {
@@ -508,38 +659,136 @@ func (d *Driver) ControllerExpandVolume(ctx context.Context, req *csi.Controller
 		return &csi.ControllerExpandVolumeResponse{CapacityBytes: int64(volume.SizeGigabytes) * BytesInGigabyte, NodeExpansionRequired: true}, nil
 	}
 
-	if volume.Status != "available" {
-		return nil, status.Error(codes.FailedPrecondition, "volume is not in an availble state for OFFLINE expansion")
+	switch {
+	case volume.Status == "available":
+		if err := d.resizeVolume(account.client, volume, desiredSize); err != nil {
+			return nil, err
+		}
+	case volume.Status == "attached":
+		// The Civo API can only resize detached volumes, and a volume can't be detached from under a pod that's using
+		// it, so it's only detached if nothing in Kubernetes is using it and the StorageClass allows it
+		pv := d.detachUnusedToResizePersistentVolume(ctx, volID)
+		if pv == nil {
+			return nil, status.Errorf(codes.FailedPrecondition, "volume %q is attached and the Civo API can only resize detached volumes, set %s: \"true\" on the StorageClass to let the driver detach it once it's unused", volID, ParameterDetachUnusedToResize)
+		}
+		reason, err := d.volumeInUse(ctx, pv)
+		if err != nil {
+			return nil, status.Errorf(codes.Unavailable, "cannot check if volume %q is in use: %s", volID, err)
+		}
+		if reason != "" {
+			return nil, status.Errorf(codes.FailedPrecondition, "volume %q is attached and %s, the Civo API can only resize detached volumes so it can only be resized once nothing is using it", volID, reason)
+		}
+		if err := d.resizeUnusedAttachedVolume(ctx, account.client, volume, desiredSize); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, status.Errorf(codes.FailedPrecondition, "volume %q is %s, it must be available or attached to be resized", volID, volume.Status)
 	}
 
-	log.Info().Int64("size_gb", desiredSize).Str("volume_id", volID).Msg("Volume resize request sent")
-	_, err = d.CivoClient.ResizeVolume(volID, int(desiredSize))
+	volume, _ = account.client.GetVolume(volID)
+	log.Info().Int64("size_gb", int64(volume.SizeGigabytes)).Str("volume_id", volID).Msg("Volume succesfully resized")
+	return &csi.ControllerExpandVolumeResponse{
+		CapacityBytes:         int64(volume.SizeGigabytes) * BytesInGigabyte,
+		NodeExpansionRequired: true,
+	}, nil
+}
+
+// resizeVolume resizes a detached volume and waits for the Civo API to finish
+func (d *Driver) resizeVolume(client civogo.Clienter, volume *civogo.Volume, desiredSize int64) error {
+	log.Info().Int64("size_gb", desiredSize).Str("volume_id", volume.ID).Msg("Volume resize request sent")
+	_, err := client.ResizeVolume(volume.ID, int(desiredSize))
 	// Handles unexpected errors (e.g., API retry error or other upstream errors).
 	if err != nil {
 		log.Error().
 			Err(err).
-			Str("VolumeID", volID).
+			Str("VolumeID", volume.ID).
 			Msg("Failed to resize volume in Civo API")
-		return nil, status.Errorf(codes.Internal, "cannot resize volume %s: %s", volID, err.Error())
+		return status.Errorf(codes.Internal, "cannot resize volume %s: %s", volume.ID, err.Error())
 	}
 
 	// Resizes can take a while, double the number of normal retries
-	available, err := d.waitForVolumeStatus(volume, "available", CivoVolumeAvailableRetries*2)
+	available, err := d.waitForVolumeStatus(client, volume, "available", CivoVolumeAvailableRetries*2)
 	if err != nil {
 		log.Error().Err(err).Msg("Unable to wait for volume availability in Civo API")
-		return nil, err
+		return err
 	}
 
 	if !available {
-		return nil, status.Error(codes.Internal, "failed to wait for volume to be in an available state")
+		return status.Error(codes.Internal, "failed to wait for volume to be in an available state")
 	}
 
-	volume, _ = d.CivoClient.GetVolume(volID)
-	log.Info().Int64("size_gb", int64(volume.SizeGigabytes)).Str("volume_id", volID).Msg("Volume succesfully resized")
-	return &csi.ControllerExpandVolumeResponse{
-		CapacityBytes:         int64(volume.SizeGigabytes) * BytesInGigabyte,
-		NodeExpansionRequired: true,
-	}, nil
+	return nil
+}
+
+// resizeUnusedAttachedVolume detaches a volume that the Civo API still has attached to an instance but nothing in
+// Kubernetes is using, resizes it and leaves it detached, to be attached again when a pod needs it
+func (d *Driver) resizeUnusedAttachedVolume(ctx context.Context, client civogo.Clienter, volume *civogo.Volume, desiredSize int64) error {
+	log.Info().Str("volume_id", volume.ID).Str("instance_id", volume.InstanceID).Msg("Detaching unused volume to resize it")
+	d.recordVolumeEvent(ctx, volume.ID, v1.EventTypeNormal, "DetachingForResize", "Detaching unused volume %s from instance %s to resize it to %dGB", volume.ID, volume.InstanceID, desiredSize)
+
+	if _, err := client.DetachVolume(volume.ID); err != nil {
+		log.Error().Err(err).Str("volume_id", volume.ID).Msg("Unable to detach volume in Civo API")
+		return status.Errorf(codes.Internal, "cannot detach volume %s to resize it: %s", volume.ID, err)
+	}
+
+	available, err := d.waitForVolumeStatus(client, volume, "available", CivoVolumeAvailableRetries)
+	if err != nil || !available {
+		return status.Errorf(codes.Internal, "volume %s didn't detach: %v", volume.ID, err)
+	}
+
+	return d.resizeVolume(client, volume, desiredSize)
+}
+
+// detachUnusedToResizePersistentVolume returns the volume's PersistentVolume if its StorageClass allows it to be detached
+// to resize it, or nil if it doesn't. The expand request doesn't carry the VolumeContext, so it's read from the PV.
+func (d *Driver) detachUnusedToResizePersistentVolume(ctx context.Context, volumeID string) *v1.PersistentVolume {
+	pv := d.findPersistentVolume(ctx, volumeID)
+	if pv == nil {
+		return nil
+	}
+
+	if enabled, _ := strconv.ParseBool(pv.Spec.CSI.VolumeAttributes[VolumeContextDetachUnusedToResize]); !enabled {
+		return nil
+	}
+	return pv
+}
+
+// volumeInUse returns why Kubernetes is using the PersistentVolume's volume, or "" if it isn't: it has a
+// VolumeAttachment, or a pod that hasn't finished uses its PersistentVolumeClaim
+func (d *Driver) volumeInUse(ctx context.Context, pv *v1.PersistentVolume) (string, error) {
+	attachments, err := d.KubeClient.StorageV1().VolumeAttachments().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", fmt.Errorf("list VolumeAttachments: %w", err)
+	}
+	for _, attachment := range attachments.Items {
+		if attachment.Spec.Attacher == DriverName && attachment.Spec.Source.PersistentVolumeName != nil && *attachment.Spec.Source.PersistentVolumeName == pv.Name {
+			return fmt.Sprintf("has VolumeAttachment %s for node %s", attachment.Name, attachment.Spec.NodeName), nil
+		}
+	}
+
+	claim := pv.Spec.ClaimRef
+	if claim == nil {
+		return "", nil
+	}
+	pods, err := d.KubeClient.CoreV1().Pods(claim.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", fmt.Errorf("list pods in %s: %w", claim.Namespace, err)
+	}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+			continue
+		}
+		for _, volume := range pod.Spec.Volumes {
+			usesClaim := volume.PersistentVolumeClaim != nil && volume.PersistentVolumeClaim.ClaimName == claim.Name
+			// A generic ephemeral volume's claim is named after the pod and the volume
+			usesEphemeralClaim := volume.Ephemeral != nil && pod.Name+"-"+volume.Name == claim.Name
+			if usesClaim || usesEphemeralClaim {
+				return fmt.Sprintf("is used by pod %s/%s", pod.Namespace, pod.Name), nil
+			}
+		}
+	}
+
+	return "", nil
 }
 
 // ControllerGetVolume is for optional Kubernetes health checking of volumes and we don't support it yet
@@ -559,11 +808,23 @@ func (d *Driver) ValidateVolumeCapabilities(ctx context.Context, req *csi.Valida
 		return nil, status.Error(codes.InvalidArgument, "must provide VolumeCapabilities to ValidateVolumeCapabilities")
 	}
 
-	_, err := d.CivoClient.GetVolume(req.VolumeId)
+	account, err := d.civoAccount(req.GetSecrets())
+	if err != nil {
+		return nil, err
+	}
+
+	volume, err := account.client.GetVolume(req.VolumeId)
 	if err != nil {
 		return nil, status.Errorf(codes.NotFound, "Unable to fetch volume from Civo API: %s", err)
 	}
 
+	if err := d.checkVolumeOwnership(volume); err != nil {
+		if status.Code(err) != codes.FailedPrecondition {
+			return nil, err
+		}
+		return &csi.ValidateVolumeCapabilitiesResponse{Message: status.Convert(err).Message()}, nil
+	}
+
 	accessModeSupported := false
 	for _, cap := range req.VolumeCapabilities {
 		if _, ok := supportedAccessModes[cap.GetAccessMode().GetMode()]; ok {
@@ -576,6 +837,12 @@ func (d *Driver) ValidateVolumeCapabilities(ctx context.Context, req *csi.Valida
 		return nil, status.Errorf(codes.NotFound, "%v not supported", req.GetVolumeCapabilities())
 	}
 
+	for _, cap := range req.VolumeCapabilities {
+		if err := validateMountFlags(cap.GetMount().GetMountFlags()); err != nil {
+			return &csi.ValidateVolumeCapabilitiesResponse{Message: err.Error()}, nil
+		}
+	}
+
 	resp := &csi.ValidateVolumeCapabilitiesResponse{
 		Confirmed: &csi.ValidateVolumeCapabilitiesResponse_Confirmed{
 			VolumeCapabilities: req.VolumeCapabilities,
@@ -585,45 +852,160 @@ func (d *Driver) ValidateVolumeCapabilities(ctx context.Context, req *csi.Valida
 	return resp, nil
 }
 
-// ListVolumes returns the existing Civo volumes for this customer
+// ListVolumes returns the existing Civo volumes for this cluster, a page at a time if MaxEntries is set
 func (d *Driver) ListVolumes(ctx context.Context, req *csi.ListVolumesRequest) (*csi.ListVolumesResponse, error) {
-	if req.StartingToken != "" {
-		return &csi.ListVolumesResponse{}, status.Errorf(codes.Aborted, "%v not supported", "starting-token")
-	}
+	log.Info().Int32("max_entries", req.MaxEntries).Str("starting_token", req.StartingToken).Msg("Request: ListVolumes")
 
-	log.Info().Msg("Request: ListVolumes")
+	if req.MaxEntries < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "ListVolumes max_entries must not be negative, not %d", req.MaxEntries)
+	}
 
 	log.Debug().Msg("Listing all volume in Civo API")
-	volumes, err := d.CivoClient.ListVolumes()
+	volumes, err := d.listClusterVolumes(ctx)
 	if err != nil {
 		log.Error().Err(err).Msg("Unable to list volumes in Civo API")
 		return nil, err
 	}
 	log.Debug().Msg("Successfully retrieved all volumes from the Civo API")
 
+	// The Civo API doesn't promise an order, the tokens are offsets so each page has to come from the same one
+	slices.SortFunc(volumes, func(a, b civogo.Volume) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	start := 0
+	if req.StartingToken != "" {
+		start, err = strconv.Atoi(req.StartingToken)
+		if err != nil || start < 0 || start > len(volumes) {
+			return nil, status.Errorf(codes.Aborted, "ListVolumes starting_token %q is invalid", req.StartingToken)
+		}
+	}
+
+	end := len(volumes)
+	if req.MaxEntries > 0 && start+int(req.MaxEntries) < end {
+		end = start + int(req.MaxEntries)
+	}
+
 	resp := &csi.ListVolumesResponse{
 		Entries: []*csi.ListVolumesResponse_Entry{},
 	}
+	if end < len(volumes) {
+		resp.NextToken = strconv.Itoa(end)
+	}
+
+	for _, v := range volumes[start:end] {
+		volumeStatus := &csi.ListVolumesResponse_VolumeStatus{}
+		if v.InstanceID != "" {
+			volumeStatus.PublishedNodeIds = []string{v.InstanceID}
+		}
 
-	for _, v := range volumes {
 		resp.Entries = append(resp.Entries, &csi.ListVolumesResponse_Entry{
 			Volume: &csi.Volume{
-				CapacityBytes: int64(v.SizeGigabytes) * BytesInGigabyte,
-				VolumeId:      v.ID,
-				ContentSource: &csi.VolumeContentSource{
-					Type: &csi.VolumeContentSource_Volume{},
-				},
+				CapacityBytes:      int64(v.SizeGigabytes) * BytesInGigabyte,
+				VolumeId:           v.ID,
+				AccessibleTopology: d.volumeTopology(),
 			},
-			Status: &csi.ListVolumesResponse_VolumeStatus{},
+			Status: volumeStatus,
 		})
 	}
 
+	log.Debug().Int("entries", len(resp.Entries)).Str("next_token", resp.NextToken).Msg("Volumes listed")
+
 	return resp, nil
 }
 
+// listClusterVolumes returns the volumes ListVolumes lists: the ones created for the cluster (or every volume in the
+// account with ListAllVolumes), and the volume of every PersistentVolume provisioned by this driver. Those include
+// adopted volumes created for another cluster or none, and volumes in other Civo accounts. external-attacher marks the
+// VolumeAttachment of any volume that isn't listed as detached, so they mustn't be left out.
+func (d *Driver) listClusterVolumes(ctx context.Context) ([]civogo.Volume, error) {
+	volumes, err := d.CivoClient.ListVolumes()
+	if err != nil {
+		return nil, err
+	}
+
+	listed := map[string]civogo.Volume{}
+	accountVolumes := map[string]civogo.Volume{}
+	for _, volume := range volumes {
+		// Other clusters' volumes and disks that aren't used by Kubernetes are in the same account
+		if d.ClusterID == "" || d.ListAllVolumes || volume.ClusterID == d.ClusterID {
+			listed[volume.ID] = volume
+		}
+		accountVolumes[volume.ID] = volume
+	}
+
+	if d.KubeClient != nil {
+		pvs, err := d.KubeClient.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, status.Errorf(codes.Unavailable, "cannot list PersistentVolumes: %s", err)
+		}
+
+		// The volume IDs wanted from each other Civo account, by its client
+		wanted := map[civogo.Clienter][]string{}
+		for i, pv := range pvs.Items {
+			if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != DriverName {
+				continue
+			}
+			volumeID := pv.Spec.CSI.VolumeHandle
+			if _, ok := listed[volumeID]; ok {
+				continue
+			}
+			if volume, ok := accountVolumes[volumeID]; ok {
+				listed[volumeID] = volume
+				continue
+			}
+
+			ref := persistentVolumeSecretRef(&pvs.Items[i])
+			if ref == nil {
+				continue
+			}
+			account, err := d.secretCivoAccount(ctx, ref)
+			if err != nil {
+				return nil, status.Errorf(codes.Unavailable, "cannot find the Civo account of PersistentVolume %s: %s", pv.Name, err)
+			}
+			wanted[account.client] = append(wanted[account.client], volumeID)
+		}
+
+		for client, volumeIDs := range wanted {
+			volumes, err := client.ListVolumes()
+			if err != nil {
+				return nil, err
+			}
+			for _, volume := range volumes {
+				if slices.Contains(volumeIDs, volume.ID) {
+					listed[volume.ID] = volume
+				}
+			}
+		}
+	}
+
+	volumes = make([]civogo.Volume, 0, len(listed))
+	for _, volume := range listed {
+		volumes = append(volumes, volume)
+	}
+	return volumes, nil
+}
+
 // GetCapacity calls the Civo API to determine the user's available quota
-func (d *Driver) GetCapacity(context.Context, *csi.GetCapacityRequest) (*csi.GetCapacityResponse, error) {
-	log.Info().Msg("Request: GetCapacity")
+func (d *Driver) GetCapacity(ctx context.Context, req *csi.GetCapacityRequest) (*csi.GetCapacityResponse, error) {
+	log.Info().Interface("topology", req.GetAccessibleTopology()).Interface("parameters", req.GetParameters()).Msg("Request: GetCapacity")
+
+	noCapacity := &csi.GetCapacityResponse{
+		AvailableCapacity: 0,
+		MaximumVolumeSize: &wrappers.Int64Value{Value: 0},
+		MinimumVolumeSize: &wrappers.Int64Value{Value: d.MinimumVolumeSizeGB * BytesInGigabyte},
+	}
+
+	// Volumes can only be created in the controller's region
+	if region, ok := req.GetAccessibleTopology().GetSegments()[TopologyRegionKey]; ok && d.Region != "" && region != d.Region {
+		log.Debug().Str("region", region).Msg("No capacity outside the controller's region")
+		return noCapacity, nil
+	}
+
+	if _, err := d.volumeType(req.GetParameters()); err != nil {
+		log.Debug().Err(err).Msg("No capacity for an unavailable volume type")
+		return noCapacity, nil
+	}
 
 	log.Debug().Msg("Requesting available capacity in client's quota from the Civo API")
 	quota, err := d.CivoClient.GetQuota()
@@ -633,22 +1015,24 @@ func (d *Driver) GetCapacity(context.Context, *csi.GetCapacityRequest) (*csi.Get
 	}
 	log.Debug().Msg("Successfully retrieved quota from the Civo API")
 
-	availableBytes := int64(quota.DiskGigabytesLimit-quota.DiskGigabytesUsage) * BytesInGigabyte
-	log.Debug().Int64("available_gb", availableBytes/BytesInGigabyte).Msg("Available capacity determined")
-	if availableBytes < BytesInGigabyte {
-		log.Error().Int64("available_bytes", availableBytes).Msg("Available capacity is less than 1GB, volumes can't be launched")
-	}
-
-	if quota.DiskVolumeCountUsage >= quota.DiskVolumeCountLimit {
-		log.Error().Msg("Number of volumes is at the quota limit, no capacity left")
-		availableBytes = 0
+	reservedGB, reservedCount := d.quotaReservations.total()
+	availableGB := availableCapacityGB(quota, reservedGB, reservedCount)
+	log.Debug().Int64("available_gb", availableGB).Msg("Available capacity determined")
+	if availableGB < d.MinimumVolumeSizeGB {
+		log.Error().Int64("available_gb", availableGB).Int("volume_count_usage", quota.DiskVolumeCountUsage).Int("volume_count_limit", quota.DiskVolumeCountLimit).Msg("Quota doesn't have room for another volume")
+		return noCapacity, nil
 	}
 
-	resp := &csi.GetCapacityResponse{
-		AvailableCapacity: availableBytes,
+	maximumGB := availableGB
+	if d.MaximumVolumeSizeGB > 0 && d.MaximumVolumeSizeGB < maximumGB {
+		maximumGB = d.MaximumVolumeSizeGB
 	}
 
-	return resp, nil
+	return &csi.GetCapacityResponse{
+		AvailableCapacity: availableGB * BytesInGigabyte,
+		MaximumVolumeSize: &wrappers.Int64Value{Value: maximumGB * BytesInGigabyte},
+		MinimumVolumeSize: &wrappers.Int64Value{Value: d.MinimumVolumeSizeGB * BytesInGigabyte},
+	}, nil
 }
 
 // ControllerGetCapabilities returns the capabilities of the controller, what features it implements
@@ -659,6 +1043,7 @@ func (d *Driver) ControllerGetCapabilities(context.Context, *csi.ControllerGetCa
 		csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
 		csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME,
 		csi.ControllerServiceCapability_RPC_LIST_VOLUMES,
+		csi.ControllerServiceCapability_RPC_LIST_VOLUMES_PUBLISHED_NODES,
 		csi.ControllerServiceCapability_RPC_GET_CAPACITY,
 		csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
 		// csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT, TODO: Uncomment after client implementation is complete.
@@ -916,20 +1301,6 @@ func (d *Driver) ListSnapshots(ctx context.Context, req *csi.ListSnapshotsReques
 	return nil, status.Error(codes.Unimplemented, "")
 }
 
-func getVolSizeInBytes(capRange *csi.CapacityRange) (int64, error) {
-	if capRange == nil {
-		return int64(DefaultVolumeSizeGB) * BytesInGigabyte, nil
-	}
-
-	// Volumes can be of a flexible size, but they must specify one of the fields, so we'll use that
-	bytes := capRange.GetRequiredBytes()
-	if bytes == 0 {
-		bytes = capRange.GetLimitBytes()
-	}
-
-	return bytes, nil
-}
-
 // Todo: Un-comment post client implementation is complete
 // Todo: Snapshot to be defined in civogo
 // convertSnapshot function converts a civogo.Snapshot object(API response) into a CSI ListSnapshotsResponse_Entry
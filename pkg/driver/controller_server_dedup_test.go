@@ -13,6 +13,8 @@ import (
 	"github.com/civo/civogo"
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // fakeWithHooks embeds the real FakeClient and overrides NewVolume / ListVolumes
@@ -26,6 +28,9 @@ type fakeWithHooks struct {
 	newVolumeCalls   int32
 	newVolumeBlockOn chan struct{} // if non-nil, NewVolume blocks until this is closed
 	listVolumeCalls  int32
+	countQuota       bool // if true, NewVolume adds the volume to the quota usage like the Civo API
+	getVolumeCalls   int32
+	getVolumeBlockOn chan struct{} // if non-nil, GetVolume blocks until this is closed
 }
 
 func (f *fakeWithHooks) NewVolume(v *civogo.VolumeConfig) (*civogo.VolumeResult, error) {
@@ -38,9 +43,29 @@ func (f *fakeWithHooks) NewVolume(v *civogo.VolumeConfig) (*civogo.VolumeResult,
 	if f.newVolumeErr != nil {
 		return nil, f.newVolumeErr
 	}
+	if f.countQuota {
+		f.FakeClient.Quota.DiskGigabytesUsage += v.SizeGigabytes
+		f.FakeClient.Quota.DiskVolumeCountUsage++
+	}
 	return f.FakeClient.NewVolume(v)
 }
 
+func (f *fakeWithHooks) GetQuota() (*civogo.Quota, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.FakeClient.GetQuota()
+}
+
+func (f *fakeWithHooks) GetVolume(id string) (*civogo.Volume, error) {
+	atomic.AddInt32(&f.getVolumeCalls, 1)
+	if f.getVolumeBlockOn != nil {
+		<-f.getVolumeBlockOn
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.FakeClient.GetVolume(id)
+}
+
 func (f *fakeWithHooks) ListVolumes() ([]civogo.Volume, error) {
 	atomic.AddInt32(&f.listVolumeCalls, 1)
 	return f.FakeClient.ListVolumes()
@@ -120,6 +145,102 @@ func TestCreateVolume_SingleflightCoalescesConcurrentCalls(t *testing.T) {
 	assert.Equal(t, int32(1), atomic.LoadInt32(&fc.listVolumeCalls), "expected exactly one ListVolumes call inside singleflight")
 }
 
+// TestCreateVolume_ReservesQuotaForConcurrentCreates blocks one CreateVolume
+// inside NewVolume, where the Civo API's quota doesn't count it yet. A create
+// with a different name that only fits in the quota without the first must
+// fail fast with ResourceExhausted, and the reservation must be released once
+// the first create completes.
+func TestCreateVolume_ReservesQuotaForConcurrentCreates(t *testing.T) {
+	base, _ := civogo.NewFakeClient()
+	base.Quota.DiskGigabytesLimit = 15
+	base.Quota.DiskGigabytesUsage = 0
+	gate := make(chan struct{})
+	fc := &fakeWithHooks{FakeClient: base, newVolumeBlockOn: gate}
+
+	d, err := driver.NewTestDriver(nil)
+	if err != nil {
+		t.Fatalf("NewTestDriver: %v", err)
+	}
+	d.CivoClient = fc
+
+	first := make(chan error, 1)
+	go func() {
+		_, e := d.CreateVolume(context.Background(), minimalVolumeRequest("first-vol"))
+		first <- e
+	}()
+
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&fc.newVolumeCalls) == 1
+	}, 5*time.Second, 10*time.Millisecond, "first CreateVolume never reached NewVolume")
+
+	_, err = d.CreateVolume(context.Background(), minimalVolumeRequest("second-vol"))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Contains(t, err.Error(), "first-vol (10GB)")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fc.newVolumeCalls), "second create must not reach the Civo API")
+
+	close(gate)
+	select {
+	case e := <-first:
+		assert.NoError(t, e)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the first CreateVolume")
+	}
+
+	// The fake's quota doesn't count the first volume, so with its
+	// reservation released the second fits again
+	_, err = d.CreateVolume(context.Background(), minimalVolumeRequest("second-vol"))
+	assert.NoError(t, err)
+}
+
+// TestCreateVolume_ReleasesQuotaOnceVolumeIsCreated checks a volume's
+// reservation is released as soon as the Civo API has created it, which counts
+// it in the quota usage, rather than once it's become available, so it isn't
+// counted twice while the first CreateVolume waits for it.
+func TestCreateVolume_ReleasesQuotaOnceVolumeIsCreated(t *testing.T) {
+	base, _ := civogo.NewFakeClient()
+	base.Quota.DiskGigabytesLimit = 20
+	base.Quota.DiskGigabytesUsage = 0
+	gate := make(chan struct{})
+	fc := &fakeWithHooks{FakeClient: base, countQuota: true, getVolumeBlockOn: gate}
+
+	d, err := driver.NewTestDriver(nil)
+	if err != nil {
+		t.Fatalf("NewTestDriver: %v", err)
+	}
+	d.CivoClient = fc
+
+	first := make(chan error, 1)
+	go func() {
+		_, e := d.CreateVolume(context.Background(), minimalVolumeRequest("first-vol"))
+		first <- e
+	}()
+
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&fc.getVolumeCalls) == 1
+	}, 5*time.Second, 10*time.Millisecond, "first CreateVolume never waited for its volume")
+
+	second := make(chan error, 1)
+	go func() {
+		_, e := d.CreateVolume(context.Background(), minimalVolumeRequest("second-vol"))
+		second <- e
+	}()
+
+	// The second create gets as far as waiting for its own volume, so it passed the quota check
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&fc.getVolumeCalls) == 2
+	}, 5*time.Second, 10*time.Millisecond, "second CreateVolume never created its volume")
+
+	close(gate)
+	for _, result := range []chan error{first, second} {
+		select {
+		case e := <-result:
+			assert.NoError(t, e)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for CreateVolume")
+		}
+	}
+}
+
 // TestCreateVolume_DuplicateNameTriggersIdempotentLookup simulates the api-go
 // rejecting our NewVolume with database_volume_duplicate_name because a
 // concurrent retry already won the race server-side. The CSI plugin must
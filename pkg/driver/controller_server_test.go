@@ -10,8 +10,24 @@ import (
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
+// volumeConfigRecorder records the config of each volume created through the fake client, which doesn't keep it all
+type volumeConfigRecorder struct {
+	*civogo.FakeClient
+	configs []*civogo.VolumeConfig
+}
+
+func (c *volumeConfigRecorder) NewVolume(v *civogo.VolumeConfig) (*civogo.VolumeResult, error) {
+	c.configs = append(c.configs, v)
+	return c.FakeClient.NewVolume(v)
+}
+
 func TestCreateVolume(t *testing.T) {
 	t.Run("Create a default size volume", func(t *testing.T) {
 		d, _ := driver.NewTestDriver(nil)
@@ -74,6 +90,181 @@ func TestCreateVolume(t *testing.T) {
 		assert.Equal(t, 25, volumes[0].SizeGigabytes)
 	})
 
+	t.Run("Rejects a volume content source", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+
+		for _, source := range []*csi.VolumeContentSource{
+			{Type: &csi.VolumeContentSource_Snapshot{Snapshot: &csi.VolumeContentSource_SnapshotSource{SnapshotId: "snapshot-1"}}},
+			{Type: &csi.VolumeContentSource_Volume{Volume: &csi.VolumeContentSource_VolumeSource{VolumeId: "vol-1"}}},
+		} {
+			req := minimalVolumeRequest("foo")
+			req.VolumeContentSource = source
+			_, err := d.CreateVolume(context.Background(), req)
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		}
+		assert.Empty(t, fc.Volumes)
+	})
+
+	t.Run("Records the filesystem check parameter in the volume context", func(t *testing.T) {
+		d, _ := driver.NewTestDriver(nil)
+
+		resp, err := d.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+			Name: "foo",
+			VolumeCapabilities: []*csi.VolumeCapability{
+				{
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+			},
+			Parameters: map[string]string{
+				driver.ParameterFilesystemCheck: "true",
+			},
+		})
+		assert.Nil(t, err)
+
+		assert.Equal(t, "true", resp.Volume.VolumeContext[driver.VolumeContextFilesystemCheck])
+	})
+
+	t.Run("Rejects an invalid filesystem check parameter", func(t *testing.T) {
+		d, _ := driver.NewTestDriver(nil)
+
+		_, err := d.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+			Name: "foo",
+			VolumeCapabilities: []*csi.VolumeCapability{
+				{
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+			},
+			Parameters: map[string]string{
+				driver.ParameterFilesystemCheck: "sometimes",
+			},
+		})
+
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("Creates the volume in the controller's region if the topology allows it", func(t *testing.T) {
+		d, _ := driver.NewTestDriver(nil)
+
+		resp, err := d.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+			Name: "foo",
+			VolumeCapabilities: []*csi.VolumeCapability{
+				{
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+			},
+			AccessibilityRequirements: &csi.TopologyRequirement{
+				Requisite: []*csi.Topology{
+					{Segments: map[string]string{driver.TopologyRegionKey: "OTHER1"}},
+					{Segments: map[string]string{driver.TopologyRegionKey: "TEST1"}},
+				},
+				Preferred: []*csi.Topology{
+					{Segments: map[string]string{driver.TopologyRegionKey: "TEST1"}},
+				},
+			},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, []*csi.Topology{
+			{Segments: map[string]string{driver.TopologyRegionKey: "TEST1"}},
+		}, resp.Volume.AccessibleTopology)
+	})
+
+	t.Run("Rejects a requisite topology outside the controller's region", func(t *testing.T) {
+		d, _ := driver.NewTestDriver(nil)
+
+		_, err := d.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+			Name: "foo",
+			VolumeCapabilities: []*csi.VolumeCapability{
+				{
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+			},
+			AccessibilityRequirements: &csi.TopologyRequirement{
+				Requisite: []*csi.Topology{
+					{Segments: map[string]string{driver.TopologyRegionKey: "OTHER1"}},
+				},
+			},
+		})
+		assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+		volumes, _ := d.CivoClient.ListVolumes()
+		assert.Empty(t, volumes)
+	})
+
+	t.Run("Creates the volume type from the StorageClass", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+		client := &volumeConfigRecorder{FakeClient: fc}
+		d.CivoClient = client
+
+		_, err := d.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+			Name: "foo",
+			VolumeCapabilities: []*csi.VolumeCapability{
+				{
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+			},
+			Parameters: map[string]string{
+				driver.ParameterVolumeType: "ssd",
+			},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, "ssd", client.configs[0].VolumeType)
+	})
+
+	t.Run("Rejects a volume bigger than the maximum size", func(t *testing.T) {
+		d, _ := driver.NewTestDriver(nil)
+		d.MaximumVolumeSizeGB = 50
+
+		_, err := d.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+			Name: "foo",
+			VolumeCapabilities: []*csi.VolumeCapability{
+				{
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+			},
+			CapacityRange: &csi.CapacityRange{
+				RequiredBytes: 60 * driver.BytesInGigabyte,
+			},
+		})
+
+		assert.Equal(t, codes.OutOfRange, status.Code(err))
+	})
+
+	t.Run("Rejects mount options that aren't allowed", func(t *testing.T) {
+		d, _ := driver.NewTestDriver(nil)
+
+		_, err := d.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+			Name: "foo",
+			VolumeCapabilities: []*csi.VolumeCapability{
+				{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							MountFlags: []string{"remount"},
+						},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+			},
+		})
+
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
 	t.Run("Don't create if the volume already exists and just return it", func(t *testing.T) {
 		d, _ := driver.NewTestDriver(nil)
 
@@ -105,6 +296,7 @@ func TestCreateVolume(t *testing.T) {
 func TestDeleteVolume(t *testing.T) {
 	t.Run("Delete a volume", func(t *testing.T) {
 		d, _ := driver.NewTestDriver(nil)
+		d.KubeClient = fake.NewSimpleClientset()
 
 		volume, err := d.CivoClient.NewVolume(&civogo.VolumeConfig{
 			Name: "foo",
@@ -153,6 +345,186 @@ func TestControllerPublishVolume(t *testing.T) {
 		volumes, _ := d.CivoClient.ListVolumes()
 		assert.Equal(t, instanceID, volumes[0].InstanceID)
 	})
+
+	t.Run("Records a read-only attachment in the publish context", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		instanceID := "i-12345678"
+		fc.Clusters = []civogo.KubernetesCluster{{
+			ID: "12345678",
+			Instances: []civogo.KubernetesInstance{{
+				ID:       instanceID,
+				Hostname: "instance-1",
+			}},
+		}}
+		d, _ := driver.NewTestDriver(fc)
+
+		volume, err := d.CivoClient.NewVolume(&civogo.VolumeConfig{
+			Name: "foo",
+		})
+		assert.Nil(t, err)
+
+		resp, err := d.ControllerPublishVolume(context.Background(), &csi.ControllerPublishVolumeRequest{
+			VolumeId:         volume.ID,
+			NodeId:           instanceID,
+			Readonly:         true,
+			VolumeCapability: &csi.VolumeCapability{},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, "true", resp.PublishContext[driver.PublishContextReadOnly])
+	})
+
+	t.Run("Force detaches a volume from a gone or out of service instance", func(t *testing.T) {
+		instanceID := "i-12345678"
+
+		// node returns a node registered with the driver as instance i-old
+		node := func(taints ...v1.Taint) []runtime.Object {
+			return []runtime.Object{
+				&storagev1.CSINode{
+					ObjectMeta: metav1.ObjectMeta{Name: "node-old"},
+					Spec: storagev1.CSINodeSpec{
+						Drivers: []storagev1.CSINodeDriver{{Name: driver.DriverName, NodeID: "i-old"}},
+					},
+				},
+				&v1.Node{
+					ObjectMeta: metav1.ObjectMeta{Name: "node-old"},
+					Spec:       v1.NodeSpec{Taints: taints},
+				},
+			}
+		}
+
+		// deletedNode returns a node that's been deleted, but is still registered with the driver as i-old
+		deletedNode := func() []runtime.Object {
+			return node()[:1]
+		}
+
+		tests := []struct {
+			name           string
+			instanceExists bool
+			kubeObjects    []runtime.Object
+			expectedCode   codes.Code
+			expectInstance string
+		}{
+			{
+				name:           "Instance no longer exists",
+				expectedCode:   codes.OK,
+				expectInstance: instanceID,
+			},
+			{
+				name:           "Instance outside the cluster still exists",
+				instanceExists: true,
+				expectedCode:   codes.Unavailable,
+				expectInstance: "i-old",
+			},
+			{
+				name:           "Node is out of service",
+				instanceExists: true,
+				kubeObjects:    node(v1.Taint{Key: driver.OutOfServiceTaint, Value: "nodeshutdown", Effect: v1.TaintEffectNoExecute}),
+				expectedCode:   codes.OK,
+				expectInstance: instanceID,
+			},
+			{
+				name:           "Node is healthy",
+				instanceExists: true,
+				kubeObjects:    node(),
+				expectedCode:   codes.Unavailable,
+				expectInstance: "i-old",
+			},
+			{
+				name:           "Node was deleted but its instance still exists",
+				instanceExists: true,
+				kubeObjects:    deletedNode(),
+				expectedCode:   codes.Unavailable,
+				expectInstance: "i-old",
+			},
+			{
+				name:           "Node was deleted with its instance",
+				kubeObjects:    deletedNode(),
+				expectedCode:   codes.OK,
+				expectInstance: instanceID,
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				fc, _ := civogo.NewFakeClient()
+				fc.Clusters = []civogo.KubernetesCluster{{ID: "12345678", Instances: []civogo.KubernetesInstance{{ID: instanceID, Hostname: "instance-1"}}}}
+				if tt.instanceExists {
+					fc.Instances = []civogo.Instance{{ID: "i-old", Hostname: "instance-old"}}
+				}
+				fc.Volumes = []civogo.Volume{{ID: "vol-1", InstanceID: "i-old", Status: "attached", SizeGigabytes: 10}}
+				d, _ := driver.NewTestDriver(fc)
+				if tt.kubeObjects != nil {
+					d.KubeClient = fake.NewSimpleClientset(tt.kubeObjects...)
+				}
+
+				_, err := d.ControllerPublishVolume(context.Background(), &csi.ControllerPublishVolumeRequest{
+					VolumeId:         "vol-1",
+					NodeId:           instanceID,
+					VolumeCapability: &csi.VolumeCapability{},
+				})
+				assert.Equal(t, tt.expectedCode, status.Code(err))
+				assert.Equal(t, tt.expectInstance, fc.Volumes[0].InstanceID)
+			})
+		}
+	})
+
+	t.Run("Checks an existing volume before adopting it", func(t *testing.T) {
+		instanceID := "i-12345678"
+
+		tests := []struct {
+			name         string
+			volume       civogo.Volume
+			expectedCode codes.Code
+		}{
+			{
+				name:         "Adopts a volume whose cluster was deleted",
+				volume:       civogo.Volume{ID: "vol-1", ClusterID: "deleted-cluster", NetworkID: "net-1", Status: "available", SizeGigabytes: 10},
+				expectedCode: codes.OK,
+			},
+			{
+				name:         "Refuses another cluster's volume",
+				volume:       civogo.Volume{ID: "vol-1", ClusterID: "other-cluster", Status: "available", SizeGigabytes: 10},
+				expectedCode: codes.FailedPrecondition,
+			},
+			{
+				name:         "Refuses a volume on another network",
+				volume:       civogo.Volume{ID: "vol-1", NetworkID: "net-2", Status: "available", SizeGigabytes: 10},
+				expectedCode: codes.FailedPrecondition,
+			},
+			{
+				name:         "Refuses a volume attached outside the cluster",
+				volume:       civogo.Volume{ID: "vol-1", InstanceID: "i-elsewhere", Status: "attached", SizeGigabytes: 10},
+				expectedCode: codes.FailedPrecondition,
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				fc, _ := civogo.NewFakeClient()
+				fc.Clusters = []civogo.KubernetesCluster{
+					{
+						ID:        "12345678",
+						NetworkID: "net-1",
+						Instances: []civogo.KubernetesInstance{{
+							ID:       instanceID,
+							Hostname: "instance-1",
+						}},
+					},
+					{ID: "other-cluster"},
+				}
+				fc.Volumes = []civogo.Volume{tt.volume}
+				d, _ := driver.NewTestDriver(fc)
+
+				_, err := d.ControllerPublishVolume(context.Background(), &csi.ControllerPublishVolumeRequest{
+					VolumeId:         tt.volume.ID,
+					NodeId:           instanceID,
+					VolumeCapability: &csi.VolumeCapability{},
+					VolumeContext:    map[string]string{driver.VolumeContextAdopt: "true"},
+				})
+				assert.Equal(t, tt.expectedCode, status.Code(err))
+			})
+		}
+	})
 }
 
 func TestControllerUnpublishVolume(t *testing.T) {
@@ -210,6 +582,42 @@ func TestControllerUnpublishVolume(t *testing.T) {
 	})
 }
 
+func TestValidateVolumeCapabilities(t *testing.T) {
+	capabilities := []*csi.VolumeCapability{{
+		AccessMode: &csi.VolumeCapability_AccessMode{
+			Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		},
+	}}
+
+	t.Run("Confirms this cluster's volume", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+		fc.Volumes = []civogo.Volume{{ID: "vol-1", ClusterID: d.ClusterID, Status: "available"}}
+
+		resp, err := d.ValidateVolumeCapabilities(context.Background(), &csi.ValidateVolumeCapabilitiesRequest{
+			VolumeId:           "vol-1",
+			VolumeCapabilities: capabilities,
+		})
+		assert.Nil(t, err)
+		assert.NotNil(t, resp.Confirmed)
+	})
+
+	t.Run("Doesn't confirm another cluster's volume", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		fc.Clusters = []civogo.KubernetesCluster{{ID: "other-cluster"}}
+		d, _ := driver.NewTestDriver(fc)
+		fc.Volumes = []civogo.Volume{{ID: "vol-1", ClusterID: "other-cluster", Status: "available"}}
+
+		resp, err := d.ValidateVolumeCapabilities(context.Background(), &csi.ValidateVolumeCapabilitiesRequest{
+			VolumeId:           "vol-1",
+			VolumeCapabilities: capabilities,
+		})
+		assert.Nil(t, err)
+		assert.Nil(t, resp.Confirmed)
+		assert.Contains(t, resp.Message, "other-cluster")
+	})
+}
+
 func TestListVolumes(t *testing.T) {
 	t.Run("Lists available existing volumes", func(t *testing.T) {
 		fc, _ := civogo.NewFakeClient()
@@ -219,6 +627,7 @@ func TestListVolumes(t *testing.T) {
 			Name: "foo",
 		})
 		assert.Nil(t, err)
+		fc.Volumes[0].ClusterID = d.ClusterID // the fake Civo API doesn't keep it
 
 		resp, err := d.ListVolumes(context.Background(), &csi.ListVolumesRequest{
 			MaxEntries:    20,
@@ -228,6 +637,153 @@ func TestListVolumes(t *testing.T) {
 
 		assert.Equal(t, volume.ID, resp.Entries[0].Volume.VolumeId)
 	})
+
+	clusterVolumes := func(clusterID string) []civogo.Volume {
+		return []civogo.Volume{
+			{ID: "vol-c", ClusterID: clusterID, SizeGigabytes: 10},
+			{ID: "vol-other", ClusterID: "another-cluster", SizeGigabytes: 10},
+			{ID: "vol-a", ClusterID: clusterID, SizeGigabytes: 10, InstanceID: "instance-1", Status: "attached"},
+			{ID: "vol-unmanaged", SizeGigabytes: 10},
+			{ID: "vol-b", ClusterID: clusterID, SizeGigabytes: 20},
+		}
+	}
+
+	t.Run("Only lists this cluster's volumes in a stable order", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+		fc.Volumes = clusterVolumes(d.ClusterID)
+
+		resp, err := d.ListVolumes(context.Background(), &csi.ListVolumesRequest{})
+		assert.Nil(t, err)
+
+		ids := []string{}
+		for _, entry := range resp.Entries {
+			ids = append(ids, entry.Volume.VolumeId)
+		}
+		assert.Equal(t, []string{"vol-a", "vol-b", "vol-c"}, ids)
+		assert.Empty(t, resp.NextToken)
+		assert.Equal(t, []string{"instance-1"}, resp.Entries[0].Status.PublishedNodeIds)
+		assert.Empty(t, resp.Entries[1].Status.PublishedNodeIds)
+		assert.Nil(t, resp.Entries[0].Volume.ContentSource)
+	})
+
+	t.Run("Lists every volume in the account if asked to", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+		d.ListAllVolumes = true
+		fc.Volumes = clusterVolumes(d.ClusterID)
+
+		resp, err := d.ListVolumes(context.Background(), &csi.ListVolumesRequest{})
+		assert.Nil(t, err)
+		assert.Len(t, resp.Entries, 5)
+	})
+
+	// csiPV returns a PersistentVolume for the volume, provisioned by this driver
+	csiPV := func(name, volumeID string, secretRef *v1.SecretReference) *v1.PersistentVolume {
+		return &v1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: v1.PersistentVolumeSpec{
+				PersistentVolumeSource: v1.PersistentVolumeSource{
+					CSI: &v1.CSIPersistentVolumeSource{
+						Driver:                     driver.DriverName,
+						VolumeHandle:               volumeID,
+						ControllerPublishSecretRef: secretRef,
+					},
+				},
+			},
+		}
+	}
+
+	listedIDs := func(resp *csi.ListVolumesResponse) []string {
+		ids := []string{}
+		for _, entry := range resp.Entries {
+			ids = append(ids, entry.Volume.VolumeId)
+		}
+		return ids
+	}
+
+	t.Run("Lists the volumes of the driver's PersistentVolumes", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+		fc.Volumes = clusterVolumes(d.ClusterID)
+		d.KubeClient = fake.NewSimpleClientset(
+			csiPV("pvc-adopted", "vol-unmanaged", nil),
+			csiPV("pvc-deleted", "vol-deleted", nil),
+		)
+
+		resp, err := d.ListVolumes(context.Background(), &csi.ListVolumesRequest{})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"vol-a", "vol-b", "vol-c", "vol-unmanaged"}, listedIDs(resp))
+	})
+
+	t.Run("Lists the volumes of PersistentVolumes in other Civo accounts", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+		fc.Volumes = clusterVolumes(d.ClusterID)
+
+		teamA, _ := civogo.NewFakeClient()
+		teamA.Volumes = []civogo.Volume{
+			{ID: "vol-team-a", SizeGigabytes: 10, InstanceID: "instance-2", Status: "attached"},
+			{ID: "vol-team-a-unused", SizeGigabytes: 10},
+		}
+		d.NewCivoClient = func(apiKey, apiURL, region string) (civogo.Clienter, error) {
+			return teamA, nil
+		}
+		d.KubeClient = fake.NewSimpleClientset(
+			csiPV("pvc-team-a", "vol-team-a", &v1.SecretReference{Name: "team-a-civo", Namespace: "kube-system"}),
+			&v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "team-a-civo", Namespace: "kube-system"},
+				Data:       map[string][]byte{driver.SecretAPIKey: []byte("team-a-key")},
+			},
+		)
+
+		resp, err := d.ListVolumes(context.Background(), &csi.ListVolumesRequest{})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"vol-a", "vol-b", "vol-c", "vol-team-a"}, listedIDs(resp))
+		assert.Equal(t, []string{"instance-2"}, resp.Entries[3].Status.PublishedNodeIds)
+	})
+
+	t.Run("Fails if a PersistentVolume's Civo account can't be found", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+		fc.Volumes = clusterVolumes(d.ClusterID)
+		d.KubeClient = fake.NewSimpleClientset(
+			csiPV("pvc-team-a", "vol-team-a", &v1.SecretReference{Name: "team-a-civo", Namespace: "kube-system"}),
+		)
+
+		_, err := d.ListVolumes(context.Background(), &csi.ListVolumesRequest{})
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+	})
+
+	t.Run("Pages through the volumes", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+		fc.Volumes = clusterVolumes(d.ClusterID)
+
+		resp, err := d.ListVolumes(context.Background(), &csi.ListVolumesRequest{MaxEntries: 2})
+		assert.Nil(t, err)
+		assert.Len(t, resp.Entries, 2)
+		assert.Equal(t, "vol-a", resp.Entries[0].Volume.VolumeId)
+		assert.Equal(t, "vol-b", resp.Entries[1].Volume.VolumeId)
+		assert.NotEmpty(t, resp.NextToken)
+
+		resp, err = d.ListVolumes(context.Background(), &csi.ListVolumesRequest{MaxEntries: 2, StartingToken: resp.NextToken})
+		assert.Nil(t, err)
+		assert.Len(t, resp.Entries, 1)
+		assert.Equal(t, "vol-c", resp.Entries[0].Volume.VolumeId)
+		assert.Empty(t, resp.NextToken)
+	})
+
+	t.Run("Rejects an invalid starting token", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+		fc.Volumes = clusterVolumes(d.ClusterID)
+
+		for _, token := range []string{"invalid-token", "-1", "4"} {
+			_, err := d.ListVolumes(context.Background(), &csi.ListVolumesRequest{StartingToken: token})
+			assert.Equal(t, codes.Aborted, status.Code(err), token)
+		}
+	})
 }
 
 func TestGetCapacity(t *testing.T) {
@@ -288,16 +844,55 @@ func TestGetCapacity(t *testing.T) {
 		})
 		assert.Nil(t, err)
 
+		assert.Equal(t, int64(0), resp.AvailableCapacity)
+		assert.Equal(t, int64(0), resp.MaximumVolumeSize.GetValue())
+	})
+
+	t.Run("Returns the volume size bounds", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+		d.MinimumVolumeSizeGB = 5
+		d.MaximumVolumeSizeGB = 30
+
+		fc.Quota.DiskGigabytesUsage = 20
+		fc.Quota.DiskGigabytesLimit = 100
+
+		resp, err := d.GetCapacity(context.Background(), &csi.GetCapacityRequest{
+			AccessibleTopology: &csi.Topology{
+				Segments: map[string]string{driver.TopologyRegionKey: "TEST1"},
+			},
+		})
+		assert.Nil(t, err)
+
+		assert.Equal(t, 80*driver.BytesInGigabyte, resp.AvailableCapacity)
+		assert.Equal(t, 30*driver.BytesInGigabyte, resp.MaximumVolumeSize.GetValue())
+		assert.Equal(t, 5*driver.BytesInGigabyte, resp.MinimumVolumeSize.GetValue())
+	})
+
+	t.Run("Has no capacity outside the controller's region", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+
+		resp, err := d.GetCapacity(context.Background(), &csi.GetCapacityRequest{
+			AccessibleTopology: &csi.Topology{
+				Segments: map[string]string{driver.TopologyRegionKey: "OTHER1"},
+			},
+		})
+		assert.Nil(t, err)
+
 		assert.Equal(t, int64(0), resp.AvailableCapacity)
 	})
 }
 
 func TestControllerExpandVolume(t *testing.T) {
+	pvName := "pvc-1"
 	tests := []struct {
 		name           string
 		volumeID       string
 		capacityRange  *csi.CapacityRange
 		initialVolume  *civogo.Volume
+		detachUnused   bool
+		kubeObjects    []runtime.Object
 		expectedError  error
 		expectedSizeGB int64
 	}{
@@ -366,7 +961,7 @@ func TestControllerExpandVolume(t *testing.T) {
 			expectedSizeGB: 0,
 		},
 		{
-			name:     "Volume is not available for expansion",
+			name:     "Volume is attached without detaching unused volumes enabled",
 			volumeID: "vol-123",
 			capacityRange: &csi.CapacityRange{
 				RequiredBytes: 20 * driver.BytesInGigabyte,
@@ -375,8 +970,92 @@ func TestControllerExpandVolume(t *testing.T) {
 				ID:            "vol-123",
 				SizeGigabytes: 10,
 				Status:        "attached",
+				InstanceID:    "i-12345678",
 			},
-			expectedError:  status.Error(codes.FailedPrecondition, "volume is not in an availble state for OFFLINE expansion"),
+			expectedError:  status.Error(codes.FailedPrecondition, `volume "vol-123" is attached and the Civo API can only resize detached volumes, set csi.civo.com/detach-unused-to-resize: "true" on the StorageClass to let the driver detach it once it's unused`),
+			expectedSizeGB: 0,
+		},
+		{
+			name:     "Volume is attached with detaching unused volumes enabled",
+			volumeID: "vol-123",
+			capacityRange: &csi.CapacityRange{
+				RequiredBytes: 20 * driver.BytesInGigabyte,
+			},
+			initialVolume: &civogo.Volume{
+				ID:            "vol-123",
+				SizeGigabytes: 10,
+				Status:        "attached",
+				InstanceID:    "i-12345678",
+			},
+			detachUnused:   true,
+			expectedError:  nil,
+			expectedSizeGB: 20,
+		},
+		{
+			name:     "Volume is attached and has a VolumeAttachment with detaching unused volumes enabled",
+			volumeID: "vol-123",
+			capacityRange: &csi.CapacityRange{
+				RequiredBytes: 20 * driver.BytesInGigabyte,
+			},
+			initialVolume: &civogo.Volume{
+				ID:            "vol-123",
+				SizeGigabytes: 10,
+				Status:        "attached",
+				InstanceID:    "i-12345678",
+			},
+			detachUnused: true,
+			kubeObjects: []runtime.Object{&storagev1.VolumeAttachment{
+				ObjectMeta: metav1.ObjectMeta{Name: "csi-1"},
+				Spec: storagev1.VolumeAttachmentSpec{
+					Attacher: driver.DriverName,
+					NodeName: "node-1",
+					Source:   storagev1.VolumeAttachmentSource{PersistentVolumeName: &pvName},
+				},
+			}},
+			expectedError:  status.Error(codes.FailedPrecondition, `volume "vol-123" is attached and has VolumeAttachment csi-1 for node node-1, the Civo API can only resize detached volumes so it can only be resized once nothing is using it`),
+			expectedSizeGB: 0,
+		},
+		{
+			name:     "Volume is attached and used by a pod with detaching unused volumes enabled",
+			volumeID: "vol-123",
+			capacityRange: &csi.CapacityRange{
+				RequiredBytes: 20 * driver.BytesInGigabyte,
+			},
+			initialVolume: &civogo.Volume{
+				ID:            "vol-123",
+				SizeGigabytes: 10,
+				Status:        "attached",
+				InstanceID:    "i-12345678",
+			},
+			detachUnused: true,
+			kubeObjects: []runtime.Object{&v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "db-0", Namespace: "default"},
+				Spec: v1.PodSpec{
+					Volumes: []v1.Volume{{
+						Name: "data",
+						VolumeSource: v1.VolumeSource{
+							PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: "data-db-0"},
+						},
+					}},
+				},
+				Status: v1.PodStatus{Phase: v1.PodRunning},
+			}},
+			expectedError:  status.Error(codes.FailedPrecondition, `volume "vol-123" is attached and is used by pod default/db-0, the Civo API can only resize detached volumes so it can only be resized once nothing is using it`),
+			expectedSizeGB: 0,
+		},
+		{
+			name:     "Volume is not available for expansion",
+			volumeID: "vol-123",
+			capacityRange: &csi.CapacityRange{
+				RequiredBytes: 20 * driver.BytesInGigabyte,
+			},
+			initialVolume: &civogo.Volume{
+				ID:            "vol-123",
+				SizeGigabytes: 10,
+				Status:        "attaching",
+			},
+			detachUnused:   true,
+			expectedError:  status.Error(codes.FailedPrecondition, `volume "vol-123" is attaching, it must be available or attached to be resized`),
 			expectedSizeGB: 0,
 		},
 		{
@@ -419,6 +1098,24 @@ func TestControllerExpandVolume(t *testing.T) {
 				fc.Volumes = []civogo.Volume{*tt.initialVolume}
 			}
 
+			if tt.detachUnused {
+				d.KubeClient = fake.NewSimpleClientset(append(tt.kubeObjects, &v1.PersistentVolume{
+					ObjectMeta: metav1.ObjectMeta{Name: "pvc-1"},
+					Spec: v1.PersistentVolumeSpec{
+						ClaimRef: &v1.ObjectReference{Namespace: "default", Name: "data-db-0"},
+						PersistentVolumeSource: v1.PersistentVolumeSource{
+							CSI: &v1.CSIPersistentVolumeSource{
+								Driver:       driver.DriverName,
+								VolumeHandle: tt.volumeID,
+								VolumeAttributes: map[string]string{
+									driver.VolumeContextDetachUnusedToResize: "true",
+								},
+							},
+						},
+					},
+				})...)
+			}
+
 			// Call the method under test
 			resp, err := d.ControllerExpandVolume(context.Background(), &csi.ControllerExpandVolumeRequest{
 				VolumeId:      tt.volumeID,
@@ -433,6 +1130,17 @@ func TestControllerExpandVolume(t *testing.T) {
 				assert.Equal(t, tt.expectedSizeGB*driver.BytesInGigabyte, resp.CapacityBytes)
 				assert.True(t, resp.NodeExpansionRequired)
 			}
+
+			// An attached volume is only detached to resize it if nothing is using it, and it's left detached
+			if tt.initialVolume != nil && tt.initialVolume.InstanceID != "" {
+				if tt.expectedError == nil {
+					assert.Equal(t, "", fc.Volumes[0].InstanceID)
+					assert.Equal(t, "available", fc.Volumes[0].Status)
+				} else {
+					assert.Equal(t, tt.initialVolume.InstanceID, fc.Volumes[0].InstanceID)
+					assert.Equal(t, tt.initialVolume.Status, fc.Volumes[0].Status)
+				}
+			}
 		})
 	}
 }
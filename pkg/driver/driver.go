@@ -8,6 +8,10 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
 
 	"github.com/civo/civogo"
 	"github.com/container-storage-interface/spec/lib/go/csi"
@@ -16,20 +20,49 @@ import (
 	"golang.org/x/sync/errgroup"
 	"golang.org/x/sync/singleflight"
 	"google.golang.org/grpc"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 )
 
 // Name is the name of the driver
 const Name string = "Civo CSI Driver"
 
+// DriverName is the name the driver is registered with in Kubernetes (CSIDriver, StorageClass provisioner, PVs)
+const DriverName string = "csi.civo.com"
+
 // Version is the current version of the driver to set in the User-Agent header
 var Version string = "0.0.1"
 
 // DefaultVolumeSizeGB is the default size in Gigabytes of an unspecified volume
 const DefaultVolumeSizeGB int = 10
 
+// DefaultDeviceWaitTimeout is how long NodeStageVolume waits for an attached disk to appear on the node
+const DefaultDeviceWaitTimeout = 30 * time.Second
+
 // DefaultSocketFilename is the location of the Unix domain socket for this driver
 const DefaultSocketFilename string = "unix:///var/lib/kubelet/plugins/civo-csi/csi.sock"
 
+// Mode describes which CSI services a driver instance is deployed to serve
+type Mode string
+
+const (
+	// ModeAll serves both the controller and node services from one process
+	ModeAll Mode = "all"
+	// ModeController serves the controller service, e.g. in the controller StatefulSet
+	ModeController Mode = "controller"
+	// ModeNode serves the node service, e.g. in the node DaemonSet
+	ModeNode Mode = "node"
+)
+
+// ParseMode converts a string (e.g. from a command line flag) into a Mode
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case ModeAll, ModeController, ModeNode:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown driver mode %q, must be one of %q, %q or %q", s, ModeAll, ModeController, ModeNode)
+}
+
 // Driver implement the CSI endpoints for Identity, Node and Controller
 type Driver struct {
 	CivoClient     civogo.Clienter
@@ -44,6 +77,72 @@ type Driver struct {
 	grpcServer        *grpc.Server
 	ClusterVolumeType string
 
+	// Mode selects which readiness checks apply to this instance and how
+	// expensive Probe is allowed to be
+	Mode Mode
+	// HealthAddress is the address the /healthz and /readyz HTTP server
+	// listens on, it's disabled if empty
+	HealthAddress string
+	// Filesystems the node must be able to format, mount and grow, checked
+	// before the node plugin starts serving
+	Filesystems []string
+	// DeviceWaitTimeout is how long staging waits for an attached disk to
+	// appear on the node, zero means it's only looked for once
+	DeviceWaitTimeout time.Duration
+	// UdevSettle triggers udev and waits for it to settle if an attached
+	// disk hasn't appeared yet
+	UdevSettle bool
+	// MinimumVolumeSizeGB and MaximumVolumeSizeGB bound the size of the
+	// volumes the controller creates or grows, zero means no maximum
+	MinimumVolumeSizeGB int64
+	MaximumVolumeSizeGB int64
+	// ListAllVolumes makes ListVolumes return every volume in the Civo
+	// account rather than only the ones in ClusterID
+	ListAllVolumes bool
+	// VolumeNameTemplate names the Civo volumes CreateVolume creates from
+	// the PVC's metadata, nil names them after the PV
+	VolumeNameTemplate *template.Template
+	// NewCivoClient creates the clients for Civo API keys passed in CSI
+	// secrets, CivoClient is used for requests without secrets. APIURL is
+	// the Civo API URL they use unless the secrets have their own.
+	NewCivoClient CivoClientFactory
+	APIURL        string
+	// CivoAccountIdleTimeout is how long the client for an API key from
+	// CSI secrets is kept after it was last used
+	CivoAccountIdleTimeout time.Duration
+	// OrphanScanInterval is how often the controller looks for volumes in
+	// ClusterID without a PersistentVolume, zero disables it
+	OrphanScanInterval time.Duration
+	// OrphanGracePeriod is how long a volume must have been orphaned
+	// before it's deleted
+	OrphanGracePeriod time.Duration
+	// OrphanDeletion is what happens to volumes orphaned for longer than
+	// the grace period
+	OrphanDeletion OrphanDeletion
+	// AttachmentReconcileInterval is how often the controller detaches
+	// volumes from instances that are no longer in the cluster, zero
+	// disables it
+	AttachmentReconcileInterval time.Duration
+	// ReleasedVolumesNamespace is the namespace of the ConfigMap recording
+	// the volumes DeleteVolume released instead of deleting
+	ReleasedVolumesNamespace string
+
+	// KubeClient is an optional Kubernetes API client, used to find the
+	// PersistentVolume behind a volume ID
+	KubeClient kubernetes.Interface
+	// EventRecorder records Kubernetes events about volumes, events are
+	// skipped if it's nil
+	EventRecorder record.EventRecorder
+
+	// serving is set once the gRPC server has started accepting requests
+	serving atomic.Bool
+
+	// nodeDetailsMu guards the cached node identity, which is resolved
+	// lazily because it may require a call to the Civo API
+	nodeDetailsMu  sync.Mutex
+	nodeInstanceID string
+	nodeRegion     string
+
 	// volumeCreateGroup coalesces concurrent CreateVolume gRPC handlers for
 	// the same req.Name in this pod into a single call into the Civo API.
 	// CSI external-provisioner retries the gRPC call on transient errors;
@@ -52,6 +151,22 @@ type Driver struct {
 	// CivoVolume CRs. Per-name singleflight is sufficient because the
 	// controller deployment is replicas: 1.
 	volumeCreateGroup singleflight.Group
+
+	// quotaReservations holds the quota of the volumes being created, which
+	// the Civo API doesn't count until they exist
+	quotaReservations quotaReservations
+
+	// civoAccounts pools the clients for the Civo API keys passed in CSI
+	// secrets, and the quota reserved in each account
+	civoAccounts civoAccounts
+
+	// orphansMu guards when each orphaned volume was first seen, which
+	// starts its grace period
+	orphansMu        sync.Mutex
+	orphansFirstSeen map[string]time.Time
+
+	// metrics are served on /metrics by the health server
+	metrics metrics
 }
 
 // NewDriver returns a CSI driver that implements gRPC endpoints for CSI
@@ -74,6 +189,15 @@ func NewDriver(apiURL, apiKey, region, namespace, clusterID string) (*Driver, er
 
 	client.SetUserAgent(userAgent)
 
+	newCivoClient := func(apiKey, apiURL, region string) (civogo.Clienter, error) {
+		client, err := civogo.NewClientWithURL(apiKey, apiURL, region)
+		if err != nil {
+			return nil, err
+		}
+		client.SetUserAgent(userAgent)
+		return client, nil
+	}
+
 	socketFilename := os.Getenv("CSI_ENDPOINT")
 	if socketFilename == "" {
 		socketFilename = DefaultSocketFilename
@@ -82,14 +206,25 @@ func NewDriver(apiURL, apiKey, region, namespace, clusterID string) (*Driver, er
 	log.Info().Str("api_url", apiURL).Str("region", region).Str("namespace", namespace).Str("cluster_id", clusterID).Str("socketFilename", socketFilename).Str("user_agent", userAgent.Name).Msg("Created a new driver")
 
 	return &Driver{
-		CivoClient:     client,
-		Region:         region,
-		Namespace:      namespace,
-		ClusterID:      clusterID,
-		DiskHotPlugger: &RealDiskHotPlugger{},
-		controller:     (apiKey != ""),
-		SocketFilename: socketFilename,
-		grpcServer:     &grpc.Server{},
+		CivoClient:               client,
+		NewCivoClient:            newCivoClient,
+		APIURL:                   apiURL,
+		CivoAccountIdleTimeout:   DefaultCivoAccountIdleTimeout,
+		Region:                   region,
+		Namespace:                namespace,
+		ClusterID:                clusterID,
+		DiskHotPlugger:           NewRealDiskHotPlugger(),
+		controller:               (apiKey != ""),
+		Mode:                     ModeAll,
+		Filesystems:              []string{DefaultFilesystem},
+		DeviceWaitTimeout:        DefaultDeviceWaitTimeout,
+		MinimumVolumeSizeGB:      DefaultMinimumVolumeSizeGB,
+		MaximumVolumeSizeGB:      DefaultMaximumVolumeSizeGB,
+		OrphanGracePeriod:        DefaultOrphanGracePeriod,
+		OrphanDeletion:           OrphanDeletionOff,
+		ReleasedVolumesNamespace: DefaultReleasedVolumesNamespace,
+		SocketFilename:           socketFilename,
+		grpcServer:               &grpc.Server{},
 	}, nil
 }
 
@@ -103,9 +238,11 @@ func NewTestDriver(fc *civogo.FakeClient) (*Driver, error) {
 		d.CivoClient, _ = civogo.NewFakeClient()
 	}
 
-	d.DiskHotPlugger = &FakeDiskHotPlugger{}
+	// Big enough for any volume the fake Civo API's quota allows
+	d.DiskHotPlugger = &FakeDiskHotPlugger{DeviceSizeBytes: 100 * BytesInGigabyte}
 	d.TestMode = true // Just stops so much logging out of failures, as they are often expected during the tests
 	d.ClusterVolumeType = "standard"
+	d.DeviceWaitTimeout = 0 // Tests that need to wait for a disk set their own timeout
 	zerolog.SetGlobalLevel(zerolog.PanicLevel)
 
 	return d, err
@@ -113,6 +250,16 @@ func NewTestDriver(fc *civogo.FakeClient) (*Driver, error) {
 
 // Run the driver's gRPC server
 func (d *Driver) Run(ctx context.Context) error {
+	// Check the host before creating the socket, so node-driver-registrar never
+	// registers a node plugin with kubelet that would fail part way through staging
+	if d.Mode == ModeNode || d.Mode == ModeAll {
+		log.Debug().Strs("filesystems", d.Filesystems).Bool("udev_settle", d.UdevSettle).Msg("Checking host is compatible with the node plugin")
+		if err := d.DiskHotPlugger.Preflight(d.Filesystems, d.UdevSettle); err != nil {
+			log.Error().Err(err).Msg("Host preflight checks failed")
+			return err
+		}
+	}
+
 	log.Debug().Str("socketFilename", d.SocketFilename).Msg("Parsing the socket filename to make a gRPC server")
 	urlParts, _ := url.Parse(d.SocketFilename)
 	log.Debug().Msg("Parsed socket filename")
@@ -167,12 +314,32 @@ func (d *Driver) Run(ctx context.Context) error {
 		go func() {
 			<-ctx.Done()
 			log.Debug().Msg("Stopping gRPC because the context was cancelled")
+			d.serving.Store(false)
 			d.grpcServer.GracefulStop()
 		}()
 		log.Debug().Msg("Awaiting gRPC requests")
+		d.serving.Store(true)
 		return d.grpcServer.Serve(grpcListener)
 	})
 
+	if d.HealthAddress != "" {
+		eg.Go(func() error {
+			return d.runHealthServer(ctx)
+		})
+	}
+
+	if (d.Mode == ModeController || d.Mode == ModeAll) && d.OrphanScanInterval > 0 {
+		eg.Go(func() error {
+			return d.runOrphanCollector(ctx)
+		})
+	}
+
+	if (d.Mode == ModeController || d.Mode == ModeAll) && d.AttachmentReconcileInterval > 0 {
+		eg.Go(func() error {
+			return d.runAttachmentReconciler(ctx)
+		})
+	}
+
 	log.Debug().Str("grpc_address", grpcAddress).Msg("Running gRPC server, waiting for a signal to quit the process...")
 
 	return eg.Wait()
@@ -0,0 +1,54 @@
+package driver_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/civo/civo-csi/pkg/driver"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	t.Run("Refuses to start a node plugin on an incompatible host", func(t *testing.T) {
+		d, _ := driver.NewTestDriver(nil)
+		d.Mode = driver.ModeNode
+		d.DiskHotPlugger = &driver.FakeDiskHotPlugger{
+			PreflightErr: fmt.Errorf("mkfs.ext4 executable not found"),
+		}
+
+		err := d.Run(context.Background())
+		assert.EqualError(t, err, "mkfs.ext4 executable not found")
+	})
+
+	t.Run("Checks the filesystems in a list with spaces", func(t *testing.T) {
+		filesystems, err := driver.ParseFilesystems("ext4, xfs,")
+		assert.Nil(t, err)
+
+		d, _ := driver.NewTestDriver(nil)
+		d.Mode = driver.ModeNode
+		d.Filesystems = filesystems
+		hotPlugger := &driver.FakeDiskHotPlugger{PreflightErr: fmt.Errorf("stop after preflight")}
+		d.DiskHotPlugger = hotPlugger
+
+		_ = d.Run(context.Background())
+		assert.Equal(t, []string{"ext4", "xfs"}, hotPlugger.PreflightFilesystems)
+
+		_, err = driver.ParseFilesystems(" , ")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Checks for udevadm if udev is settled", func(t *testing.T) {
+		d, _ := driver.NewTestDriver(nil)
+		d.Mode = driver.ModeNode
+		d.UdevSettle = true
+		hotPlugger := &driver.FakeDiskHotPlugger{
+			PreflightErr: fmt.Errorf("udevadm executable not found"),
+		}
+		d.DiskHotPlugger = hotPlugger
+
+		err := d.Run(context.Background())
+		assert.EqualError(t, err, "udevadm executable not found")
+		assert.True(t, hotPlugger.PreflightUdevSettle)
+	})
+}
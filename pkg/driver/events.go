@@ -0,0 +1,98 @@
+package driver
+
+import (
+	"context"
+	"os"
+
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+)
+
+// EventComponent is the source component of Kubernetes events recorded by the driver
+const EventComponent string = DriverName
+
+// NewInClusterKubernetesClient returns a Kubernetes API client using the pod's service account
+func NewInClusterKubernetesClient() (kubernetes.Interface, error) {
+	cfg, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(cfg)
+}
+
+// NewEventRecorder returns an EventRecorder that sends events to the Kubernetes API using the given client
+func NewEventRecorder(client kubernetes.Interface) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+
+	return broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{
+		Component: EventComponent,
+		Host:      os.Getenv("KUBE_NODE_NAME"),
+	})
+}
+
+// recordVolumeEvent records an event against the PersistentVolume for the given volume ID. The CSI calls only
+// carry the volume ID, so the PV is looked up by its volume handle, falling back to the current node if it can't be
+// found. It does nothing if the driver doesn't have an EventRecorder.
+func (d *Driver) recordVolumeEvent(ctx context.Context, volumeID, eventType, reason, messageFmt string, args ...interface{}) {
+	if d.EventRecorder == nil {
+		return
+	}
+
+	if pv := d.findPersistentVolume(ctx, volumeID); pv != nil {
+		d.EventRecorder.Eventf(pv, eventType, reason, messageFmt, args...)
+		return
+	}
+
+	nodeName := os.Getenv("KUBE_NODE_NAME")
+	if nodeName == "" {
+		log.Debug().Str("volume_id", volumeID).Str("reason", reason).Msg("Unable to find an object to record the event against")
+		return
+	}
+
+	// Kubelet records node events with the node name as the UID, so they show up in "kubectl describe node"
+	d.EventRecorder.Eventf(&v1.ObjectReference{
+		Kind: "Node",
+		Name: nodeName,
+		UID:  types.UID(nodeName),
+	}, eventType, reason, messageFmt, args...)
+}
+
+// findPersistentVolume returns the PersistentVolume provisioned by this driver with the given volume handle, or nil
+// if there isn't a Kubernetes client or it can't be found
+func (d *Driver) findPersistentVolume(ctx context.Context, volumeID string) *v1.PersistentVolume {
+	if d.KubeClient == nil {
+		return nil
+	}
+
+	pv, err := d.lookupPersistentVolume(ctx, volumeID)
+	if err != nil {
+		log.Warn().Err(err).Str("volume_id", volumeID).Msg("Unable to list PersistentVolumes")
+		return nil
+	}
+	return pv
+}
+
+// lookupPersistentVolume returns the PersistentVolume provisioned by this driver with the given volume handle, or nil
+// if there isn't one, for callers that must tell a missing PV apart from failing to list them
+func (d *Driver) lookupPersistentVolume(ctx context.Context, volumeID string) (*v1.PersistentVolume, error) {
+	pvs, err := d.KubeClient.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, pv := range pvs.Items {
+		if pv.Spec.CSI != nil && pv.Spec.CSI.Driver == DriverName && pv.Spec.CSI.VolumeHandle == volumeID {
+			return &pvs.Items[i], nil
+		}
+	}
+
+	return nil, nil
+}
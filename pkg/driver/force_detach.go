@@ -0,0 +1,104 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/civo/civogo"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// OutOfServiceTaint is the taint added to a node that's shut down, so its volumes can be detached without the node's
+// cooperation
+const OutOfServiceTaint = "node.kubernetes.io/out-of-service"
+
+// csiNodeInstances returns the name of the node each instance is registered as with the driver, by instance ID
+func (d *Driver) csiNodeInstances(ctx context.Context) (map[string]string, error) {
+	csiNodes, err := d.KubeClient.StorageV1().CSINodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list CSINodes: %w", err)
+	}
+
+	instances := map[string]string{}
+	for _, csiNode := range csiNodes.Items {
+		for _, nodeDriver := range csiNode.Spec.Drivers {
+			if nodeDriver.Name == DriverName {
+				instances[nodeDriver.NodeID] = csiNode.Name
+			}
+		}
+	}
+	return instances, nil
+}
+
+// forceDetachReason returns why a volume can be detached from the instance it's attached to without the instance's
+// cooperation, or "" if it can't. That's if the instance's node has the out-of-service taint, or the Civo API confirms
+// the instance no longer exists. An instance that isn't one of the cluster's nodes, or whose node was deleted, may
+// still be running and using the volume, e.g. a disk attached by hand or an adopted volume, so that isn't enough.
+func (d *Driver) forceDetachReason(ctx context.Context, instanceID string) (string, error) {
+	if d.KubeClient != nil {
+		instances, err := d.csiNodeInstances(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		if nodeName, ok := instances[instanceID]; ok {
+			node, err := d.KubeClient.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				return "", fmt.Errorf("get node %s: %w", nodeName, err)
+			}
+			if err == nil {
+				for _, taint := range node.Spec.Taints {
+					if taint.Key == OutOfServiceTaint {
+						return fmt.Sprintf("node %s is out of service", nodeName), nil
+					}
+				}
+			}
+		}
+	}
+
+	gone, err := d.instanceGone(instanceID)
+	if err != nil {
+		return "", err
+	}
+	if gone {
+		return fmt.Sprintf("instance %s no longer exists", instanceID), nil
+	}
+	return "", nil
+}
+
+// instanceGone returns true if the Civo API says the instance doesn't exist
+func (d *Driver) instanceGone(instanceID string) (bool, error) {
+	_, err := d.CivoClient.GetInstance(instanceID)
+	if err == nil {
+		return false, nil
+	}
+	if strings.Contains(err.Error(), "DatabaseInstanceNotFoundError") || strings.Contains(err.Error(), "ZeroMatchesError") {
+		return true, nil
+	}
+	return false, fmt.Errorf("get instance %s: %w", instanceID, err)
+}
+
+// forceDetach detaches the volume from the instance it's attached to and waits for it to be available, so it can be
+// attached to another node
+func (d *Driver) forceDetach(ctx context.Context, client civogo.Clienter, volume *civogo.Volume, reason string) error {
+	log.Warn().Str("volume_id", volume.ID).Str("instance_id", volume.InstanceID).Str("reason", reason).Msg("Force detaching volume")
+	d.recordVolumeEvent(ctx, volume.ID, v1.EventTypeWarning, "ForceDetaching", "Detaching volume %s from instance %s as %s", volume.ID, volume.InstanceID, reason)
+
+	if _, err := client.DetachVolume(volume.ID); err != nil {
+		log.Error().Err(err).Str("volume_id", volume.ID).Msg("Unable to force detach volume in Civo API")
+		return status.Errorf(codes.Internal, "cannot detach volume %s from instance %s: %s", volume.ID, volume.InstanceID, err)
+	}
+
+	available, err := d.waitForVolumeStatus(client, volume, "available", CivoVolumeAvailableRetries)
+	if err != nil || !available {
+		return status.Errorf(codes.Unavailable, "volume %s didn't detach from instance %s: %v", volume.ID, volume.InstanceID, err)
+	}
+
+	return nil
+}
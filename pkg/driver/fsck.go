@@ -0,0 +1,103 @@
+package driver
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	utilexec "k8s.io/utils/exec"
+)
+
+// e2fsck exit codes, see e2fsck(8), the codes are a bitmask so more than one may be set
+const (
+	e2fsckErrorsCorrected     int = 1
+	e2fsckRebootRequired      int = 2
+	e2fsckErrorsUncorrected   int = 4
+	e2fsckOperationalError    int = 8
+	e2fsckUsageError          int = 16
+	e2fsckCancelled           int = 32
+	e2fsckSharedLibraryError  int = 128
+	e2fsckUnrecoverableErrors     = e2fsckOperationalError | e2fsckUsageError | e2fsckCancelled | e2fsckSharedLibraryError
+)
+
+// xfs_repair exit codes, see xfs_repair(8)
+const (
+	xfsRepairCorruptionFound int = 1
+	xfsRepairDirtyLog        int = 2
+)
+
+// FilesystemCorruptedError is returned when checking a filesystem finds errors that can't be repaired
+// automatically, so someone needs to repair it by hand before it can be mounted
+type FilesystemCorruptedError struct {
+	Path       string
+	Filesystem string
+	Output     string
+}
+
+func (e *FilesystemCorruptedError) Error() string {
+	return fmt.Sprintf("%s filesystem on %s needs to be repaired manually, check output: %s", e.Filesystem, e.Path, e.Output)
+}
+
+// CheckFilesystem checks the unmounted filesystem at the given path before it's mounted. ext4 filesystems are
+// automatically repaired where that's safe (e2fsck -p), whereas xfs filesystems are only checked (xfs_repair -n)
+// as repairing them may lose data. A *FilesystemCorruptedError is returned if the filesystem needs repairing by
+// hand, any other error means the check itself couldn't be run.
+func (p *RealDiskHotPlugger) CheckFilesystem(path, filesystem string) error {
+	log.Debug().Str("path", path).Str("filesystem", filesystem).Msg("Checking filesystem")
+
+	switch filesystem {
+	case "ext4":
+		output, exitCode, err := p.runCheck("e2fsck", "-p", path)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case exitCode&e2fsckUnrecoverableErrors != 0:
+			return fmt.Errorf("checking with 'e2fsck -p %s' failed with exit code %d output: %s", path, exitCode, output)
+		case exitCode&e2fsckErrorsUncorrected != 0:
+			return &FilesystemCorruptedError{Path: path, Filesystem: filesystem, Output: output}
+		case exitCode&(e2fsckErrorsCorrected|e2fsckRebootRequired) != 0:
+			log.Warn().Str("path", path).Str("output", output).Msg("Filesystem errors were found and corrected")
+		}
+
+	case "xfs":
+		output, exitCode, err := p.runCheck("xfs_repair", "-n", path)
+		if err != nil {
+			return err
+		}
+
+		switch exitCode {
+		case 0:
+		case xfsRepairCorruptionFound:
+			return &FilesystemCorruptedError{Path: path, Filesystem: filesystem, Output: output}
+		case xfsRepairDirtyLog:
+			// Mounting the filesystem replays the log, which is exactly what's about to happen
+			log.Info().Str("path", path).Msg("Filesystem log needs replaying, leaving it to mount")
+		default:
+			return fmt.Errorf("checking with 'xfs_repair -n %s' failed with exit code %d output: %s", path, exitCode, output)
+		}
+
+	default:
+		return fmt.Errorf("checking the %s filesystem isn't supported", filesystem)
+	}
+
+	log.Debug().Str("path", path).Str("filesystem", filesystem).Msg("Filesystem check passed")
+	return nil
+}
+
+// runCheck runs a filesystem checker, returning its output and exit code. An error is only returned if it
+// couldn't be run at all, as checkers report their findings through the exit code.
+func (p *RealDiskHotPlugger) runCheck(name string, args ...string) (string, int, error) {
+	output, err := p.Mounter.Exec.Command(name, args...).CombinedOutput()
+	log.Debug().Str("command", name).Str("output", string(output)).Msg("Filesystem check command output")
+	if err != nil {
+		var exitError utilexec.ExitError
+		if !errors.As(err, &exitError) {
+			return string(output), 0, fmt.Errorf("running %s failed: %v", name, err)
+		}
+		return string(output), exitError.ExitStatus(), nil
+	}
+
+	return string(output), 0, nil
+}
@@ -0,0 +1,141 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// HealthCheckTimeout bounds how long a single readiness check may take before it's reported as failed
+const HealthCheckTimeout = 10 * time.Second
+
+// healthCheck is a single named check reported by the /readyz endpoint
+type healthCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// readinessChecks returns the checks that must pass for this instance to be ready, depending on its mode.
+// The controller needs to reach the Civo API, whereas the node needs the host tooling and its own identity
+// (the Civo API isn't called on the node's hot path).
+func (d *Driver) readinessChecks() []healthCheck {
+	checks := []healthCheck{}
+
+	if d.Mode == ModeController || d.Mode == ModeAll {
+		// There's no leadership to check: the controller runs as a single replica StatefulSet and neither it nor its
+		// sidecars are started with leader election, so every controller that's running is the one serving requests
+		checks = append(checks, healthCheck{
+			name: "civo-api",
+			check: func(context.Context) error {
+				return d.CivoClient.Ping()
+			},
+		})
+	}
+
+	if d.Mode == ModeNode || d.Mode == ModeAll {
+		checks = append(checks,
+			healthCheck{
+				name: "host",
+				check: func(context.Context) error {
+					return d.DiskHotPlugger.Healthy()
+				},
+			},
+			healthCheck{
+				name: "node-identity",
+				check: func(context.Context) error {
+					_, _, err := d.nodeDetails()
+					return err
+				},
+			},
+		)
+	}
+
+	return checks
+}
+
+// runChecks runs each check in turn, returning a line per check and the combined error of any failures
+func runChecks(ctx context.Context, checks []healthCheck) ([]string, error) {
+	lines := make([]string, 0, len(checks))
+	var errs []error
+
+	for _, c := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, HealthCheckTimeout)
+		err := c.check(checkCtx)
+		cancel()
+
+		if err != nil {
+			lines = append(lines, fmt.Sprintf("[-]%s failed: %s", c.name, err))
+			errs = append(errs, fmt.Errorf("%s: %w", c.name, err))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("[+]%s ok", c.name))
+	}
+
+	return lines, errors.Join(errs...)
+}
+
+// HealthHandler returns an HTTP handler serving /healthz (liveness), /readyz (readiness) and /metrics
+func (d *Driver) HealthHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		// Liveness deliberately doesn't depend on anything external, otherwise
+		// a Civo API outage would restart every pod of the driver
+		if !d.serving.Load() {
+			http.Error(w, "gRPC server is not serving", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		lines, err := runChecks(r.Context(), d.readinessChecks())
+		if err != nil {
+			log.Error().Err(err).Msg("Readiness check failed")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		fmt.Fprintln(w, strings.Join(lines, "\n"))
+	})
+
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if err := d.metrics.writeTo(w); err != nil {
+			log.Error().Err(err).Msg("Unable to write metrics")
+		}
+	})
+
+	return mux
+}
+
+// runHealthServer serves HealthHandler on d.HealthAddress until the context is cancelled
+func (d *Driver) runHealthServer(ctx context.Context) error {
+	listener, err := net.Listen("tcp", d.HealthAddress)
+	if err != nil {
+		return fmt.Errorf("failed to listen for health checks on %s: %v", d.HealthAddress, err)
+	}
+
+	server := &http.Server{
+		Handler:           d.HealthHandler(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		log.Debug().Msg("Stopping health server because the context was cancelled")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Debug().Str("health_address", d.HealthAddress).Msg("Serving health checks")
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
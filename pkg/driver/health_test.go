@@ -0,0 +1,80 @@
+package driver_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/civo/civo-csi/pkg/driver"
+	"github.com/civo/civogo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthHandler(t *testing.T) {
+	t.Run("Controller is ready when the Civo API is reachable", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+		d.Mode = driver.ModeController
+
+		rec := httptest.NewRecorder()
+		d.HealthHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), "[+]civo-api ok")
+	})
+
+	t.Run("Controller isn't ready when the Civo API is unreachable", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		fc.PingErr = fmt.Errorf("something went wrong")
+		d, _ := driver.NewTestDriver(fc)
+		d.Mode = driver.ModeController
+
+		rec := httptest.NewRecorder()
+		d.HealthHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		assert.Contains(t, rec.Body.String(), "[-]civo-api failed: something went wrong")
+	})
+
+	t.Run("Node isn't ready when its identity can't be resolved", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+		d.Mode = driver.ModeNode
+
+		t.Setenv("NODE_ID", "")
+		t.Setenv("KUBE_NODE_NAME", "")
+
+		rec := httptest.NewRecorder()
+		d.HealthHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		assert.Contains(t, rec.Body.String(), "[+]host ok")
+		assert.Contains(t, rec.Body.String(), "[-]node-identity failed")
+	})
+
+	t.Run("Node is ready without calling the Civo API", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		fc.PingErr = fmt.Errorf("something went wrong")
+		d, _ := driver.NewTestDriver(fc)
+		d.Mode = driver.ModeNode
+
+		os.Setenv("NODE_ID", "instance-1")
+		os.Setenv("REGION", "TESTING")
+
+		rec := httptest.NewRecorder()
+		d.HealthHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("Liveness fails until the gRPC server is serving", func(t *testing.T) {
+		d, _ := driver.NewTestDriver(nil)
+
+		rec := httptest.NewRecorder()
+		d.HealthHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	})
+}
@@ -3,17 +3,45 @@ package driver
 import (
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"syscall"
 
+	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/sys/unix"
+	mount "k8s.io/mount-utils"
+	utilexec "k8s.io/utils/exec"
 )
 
-const BlikidNotFound int = 2
+// DevPath is where the kernel's block devices are
+const DevPath string = "/dev"
+
+// DevDiskByIDPath is where udev creates the stable symlinks for attached disks
+const DevDiskByIDPath string = "/dev/disk/by-id"
+
+// SysBlockPath lists the disks known to the kernel, whether or not udev has processed them yet
+const SysBlockPath string = "/sys/block"
+
+// partitionLinkSuffix matches the by-id symlinks udev creates for a disk's partitions
+var partitionLinkSuffix = regexp.MustCompile(`-part[0-9]+$`)
+
+// virtioSerialLength is the longest serial a virtio disk reports, longer volume IDs are truncated to it
+const virtioSerialLength int = 20
+
+// FilesystemLabel is the label of filesystems the driver formatted with the volume ID as their UUID, it's short
+// enough for both ext4 (16 characters) and xfs (12 characters)
+const FilesystemLabel string = "civo-csi"
+
+// requiredHostBinaries are the executables that must be in $PATH to stage volumes
+var requiredHostBinaries = []string{"blkid", "mkfs.ext4"}
 
 // VolumeStatistics represents the statistics of a volume
 type VolumeStatistics struct {
@@ -23,14 +51,29 @@ type VolumeStatistics struct {
 
 // DiskHotPlugger is an interface for hotplugging disks
 type DiskHotPlugger interface {
-	// PathForVolume returns the path of the hotplugged disk
-	PathForVolume(volumeID string) string
+	// PathForVolume returns the path of the hotplugged disk, or an empty path if it isn't attached
+	PathForVolume(volumeID string) (string, error)
+
+	// SettleDevices asks udev to process any newly attached disks and waits for it to finish
+	SettleDevices() error
 
-	// Format erases the path with a new empty filesystem
-	Format(path, filesystem string) error
+	// Format erases the path with a new empty filesystem, labelled as belonging to the volume
+	Format(path, filesystem, volumeID string) error
 
-	// ExpandFilesytem expands the existing file system at the given path
-	ExpandFilesystem(path string) error
+	// FilesystemIdentity returns the UUID and label of the filesystem at the path
+	FilesystemIdentity(path string) (string, string, error)
+
+	// DeviceSize returns the size in bytes of the disk at the path, as the kernel currently sees it
+	DeviceSize(path string) (int64, error)
+
+	// RescanDevice asks the kernel to read the size of the disk at the path again
+	RescanDevice(path string) error
+
+	// ExpandFilesystem grows the existing filesystem on the device, which is mounted at the mountpoint
+	ExpandFilesystem(path, mountpoint string) error
+
+	// CheckFilesystem checks (and where it's safe, repairs) the unmounted filesystem at the given path
+	CheckFilesystem(path, filesystem string) error
 
 	// Mount the path to the mountpoint, specifying the current filesystem and mount flags to use
 	Mount(path, mountpoint, filesystem string, flags ...string) error
@@ -44,25 +87,238 @@ type DiskHotPlugger interface {
 	// IsMounted returns true if the target has a disk mounted there
 	IsMounted(target string) (bool, error)
 
+	// MountSource returns the device mounted at the target, or an empty string if nothing is
+	MountSource(target string) (string, error)
+
+	// SetVolumeOwnership gives the group ownership of everything in the mounted volume, unless its root already
+	// belongs to the group
+	SetVolumeOwnership(path string, gid int) error
+
 	// GetStatistics returns capacity-related volume statistics for the given volume path.
 	GetStatistics(volumePath string) (VolumeStatistics, error)
+
+	// Healthy returns an error if the host is missing anything needed to stage volumes
+	Healthy() error
+
+	// Preflight returns an error if the host can't format, mount and grow the given filesystems, or trigger udev
+	// if udevSettle is set
+	Preflight(filesystems []string, udevSettle bool) error
+}
+
+// ownershipFileMask and ownershipDirMask are the permissions SetVolumeOwnership adds to files and directories
+const (
+	ownershipFileMask os.FileMode = 0o660
+	ownershipDirMask  os.FileMode = 0o770 | os.ModeSetgid
+)
+
+// blkidNothingFound is blkid's exit code when none of the requested tags were found
+const blkidNothingFound int = 2
+
+// partitionedDiskFormat is what mount-utils reports as the format of a disk with a partition table
+const partitionedDiskFormat string = "unknown data, probably partitions"
+
+// RealDiskHotPlugger formats, checks, mounts and grows disks on the host using mount-utils
+type RealDiskHotPlugger struct {
+	// Mounter mounts and parses the mount table, and its Exec runs blkid, mkfs and the other host tools
+	Mounter *mount.SafeFormatAndMount
+
+	// DevPath, DiskByIDPath and SysBlockPath are where disks are looked for, tests point them at a fake tree
+	DevPath      string
+	DiskByIDPath string
+	SysBlockPath string
+}
+
+// NewRealDiskHotPlugger returns a RealDiskHotPlugger that mounts and runs commands on the host
+func NewRealDiskHotPlugger() *RealDiskHotPlugger {
+	return &RealDiskHotPlugger{
+		Mounter: &mount.SafeFormatAndMount{
+			Interface: mount.New(""),
+			Exec:      utilexec.New(),
+		},
+		DevPath:      DevPath,
+		DiskByIDPath: DevDiskByIDPath,
+		SysBlockPath: SysBlockPath,
+	}
+}
+
+// PathForVolume returns the canonical path (e.g. /dev/vdb) of the hotplugged disk, or an empty path if it isn't
+// attached. The disk must be found by the exact volume ID (or its truncated virtio serial) and partitions are
+// never returned, as staging the wrong disk could destroy data, so an error listing the candidates is returned
+// if more than one disk matches. If udev hasn't created the by-id symlink, the disks' serials are checked instead.
+func (p *RealDiskHotPlugger) PathForVolume(volumeID string) (string, error) {
+	if volumeID == "" {
+		return "", errors.New("volume ID is empty")
+	}
+
+	entries, err := os.ReadDir(p.DiskByIDPath)
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("unable to read %s: %v", p.DiskByIDPath, err)
+	}
+
+	// Several links (e.g. virtio- and scsi-) may point to the same disk, so candidates are keyed by device
+	candidates := map[string][]string{}
+	for _, entry := range entries {
+		if !byIDNameMatches(entry.Name(), volumeID) {
+			continue
+		}
+
+		link := filepath.Join(p.DiskByIDPath, entry.Name())
+		device, err := filepath.EvalSymlinks(link)
+		if err != nil {
+			log.Warn().Str("volume_id", volumeID).Str("link", link).Err(err).Msg("Unable to resolve disk symlink")
+			continue
+		}
+
+		if !p.isWholeDisk(device) {
+			log.Warn().Str("volume_id", volumeID).Str("link", link).Str("device", device).Msg("Ignoring disk symlink that isn't to a whole disk")
+			continue
+		}
+
+		candidates[device] = append(candidates[device], link)
+	}
+
+	if len(candidates) == 0 {
+		return p.pathForSerial(volumeID)
+	}
+
+	return onlyCandidate(volumeID, candidates)
 }
 
-type RealDiskHotPlugger struct{}
+// byIDNameMatches returns true if the /dev/disk/by-id entry is for the whole disk with the volume ID, whether it
+// has the full ID (e.g. scsi-0QEMU_QEMU_HARDDISK_<id>) or the truncated virtio serial (virtio-<serial>)
+func byIDNameMatches(name, volumeID string) bool {
+	if partitionLinkSuffix.MatchString(name) {
+		return false
+	}
 
-// PathForVolume returns the path of the hotplugged disk
-func (p *RealDiskHotPlugger) PathForVolume(volumeID string) string {
-	matches, _ := filepath.Glob(fmt.Sprintf("/dev/disk/by-id/*%s", volumeID))
-	if len(matches) >= 1 {
-		return matches[0]
+	if name == volumeID || strings.HasSuffix(name, "-"+volumeID) || strings.HasSuffix(name, "_"+volumeID) {
+		return true
 	}
 
-	return ""
+	return len(volumeID) > virtioSerialLength && name == "virtio-"+volumeID[:virtioSerialLength]
 }
 
-// ExpandFilesystem expands the existing file system at the given path
-func (p *RealDiskHotPlugger) ExpandFilesystem(path string) error {
-	log.Debug().Str("path", path).Msg("Resizing")
+// isWholeDisk returns true if the device is a disk rather than a partition, only disks are listed directly in
+// /sys/block (partitions are nested under their disk)
+func (p *RealDiskHotPlugger) isWholeDisk(device string) bool {
+	_, err := os.Stat(filepath.Join(p.SysBlockPath, filepath.Base(device)))
+	return err == nil
+}
+
+// pathForSerial scans the serials of the kernel's block devices for the volume ID, returning the device's path
+func (p *RealDiskHotPlugger) pathForSerial(volumeID string) (string, error) {
+	serial := volumeID
+	if len(serial) > virtioSerialLength {
+		serial = serial[:virtioSerialLength]
+	}
+
+	serialFiles, _ := filepath.Glob(filepath.Join(p.SysBlockPath, "*", "serial"))
+	candidates := map[string][]string{}
+	for _, serialFile := range serialFiles {
+		content, err := os.ReadFile(serialFile)
+		if err != nil {
+			continue
+		}
+
+		if strings.TrimSpace(string(content)) == serial {
+			device := filepath.Join(p.DevPath, filepath.Base(filepath.Dir(serialFile)))
+			candidates[device] = append(candidates[device], serialFile)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return "", nil
+	}
+
+	device, err := onlyCandidate(volumeID, candidates)
+	if err == nil {
+		log.Debug().Str("volume_id", volumeID).Str("device", device).Msg("Found volume by its serial")
+	}
+	return device, err
+}
+
+// onlyCandidate returns the only device found for the volume, or an error listing them all if there's more than one
+func onlyCandidate(volumeID string, candidates map[string][]string) (string, error) {
+	if len(candidates) == 1 {
+		for device := range candidates {
+			return device, nil
+		}
+	}
+
+	found := make([]string, 0, len(candidates))
+	for device, sources := range candidates {
+		found = append(found, fmt.Sprintf("%s (from %s)", device, strings.Join(sources, ", ")))
+	}
+	sort.Strings(found)
+
+	return "", fmt.Errorf("found %d disks for volume %s, refusing to guess which to use: %s", len(found), volumeID, strings.Join(found, "; "))
+}
+
+// SettleDevices triggers udev to process add events for block devices and waits for its queue to empty, so the
+// by-id symlinks exist for any disks that were just attached
+func (p *RealDiskHotPlugger) SettleDevices() error {
+	log.Debug().Msg("Triggering udev for block devices")
+
+	output, err := p.Mounter.Exec.Command("udevadm", "trigger", "--action=add", "--subsystem-match=block").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("triggering udev with 'udevadm trigger' failed: %v output: %s", err, string(output))
+	}
+
+	output, err = p.Mounter.Exec.Command("udevadm", "settle", "--timeout=10").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("waiting for udev with 'udevadm settle' failed: %v output: %s", err, string(output))
+	}
+
+	return nil
+}
+
+// DeviceSize returns the size in bytes of the disk at the path from sysfs, which counts 512 byte sectors whatever
+// the disk's real sector size
+func (p *RealDiskHotPlugger) DeviceSize(path string) (int64, error) {
+	device, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return 0, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(p.SysBlockPath, filepath.Base(device), "size"))
+	if err != nil {
+		return 0, fmt.Errorf("reading the size of %s failed: %v", device, err)
+	}
+
+	sectors, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing the size of %s failed: %v", device, err)
+	}
+
+	return sectors * 512, nil
+}
+
+// RescanDevice asks the kernel to read the size of a SCSI disk again. Virtio disks are told about their new size by
+// the hypervisor and don't have anything to rescan, so it does nothing for them.
+func (p *RealDiskHotPlugger) RescanDevice(path string) error {
+	device, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+
+	rescan := filepath.Join(p.SysBlockPath, filepath.Base(device), "device", "rescan")
+	if _, err := os.Stat(rescan); os.IsNotExist(err) {
+		log.Debug().Str("path", device).Msg("Disk can't be rescanned")
+		return nil
+	}
+
+	log.Debug().Str("path", device).Msg("Rescanning disk")
+	if err := os.WriteFile(rescan, []byte("1"), 0o200); err != nil {
+		return fmt.Errorf("rescanning %s failed: %v", device, err)
+	}
+
+	return nil
+}
+
+// ExpandFilesystem grows the existing filesystem on the device to fill it, ext4 is grown through the device
+// whereas xfs has to be grown through the mountpoint
+func (p *RealDiskHotPlugger) ExpandFilesystem(path, mountpoint string) error {
+	log.Debug().Str("path", path).Str("mountpoint", mountpoint).Msg("Resizing")
 
 	formatted, err := p.IsFormatted(path)
 	if err != nil {
@@ -73,22 +329,40 @@ func (p *RealDiskHotPlugger) ExpandFilesystem(path string) error {
 		return fmt.Errorf("path given to expand filesystem must already be formatted: %s", path)
 	}
 
-	output, err := exec.Command("/usr/sbin/resize2fs", path).CombinedOutput()
-	log.Debug().Str("output", string(output)).Msg("Resize2fs command output")
-	if err != nil {
-		return fmt.Errorf("resizing with 'resize2fs %s' failed: %v output: %s", path, err, string(output))
+	if _, err := mount.NewResizeFs(p.Mounter.Exec).Resize(path, mountpoint); err != nil {
+		return fmt.Errorf("resizing filesystem on %s failed: %v", path, err)
 	}
 
 	return nil
 }
 
-// Format erases the path with a new empty filesystem
-func (p *RealDiskHotPlugger) Format(path, filesystem string) error {
-	log.Debug().Str("path", path).Str("filesystem", filesystem).Msg("Formatting")
+// Format erases the path with a new empty filesystem. If the volume ID is a UUID it's used as the filesystem's
+// UUID and the filesystem is labelled with FilesystemLabel, so later stages can check it's the right disk.
+func (p *RealDiskHotPlugger) Format(path, filesystem, volumeID string) error {
+	log.Debug().Str("path", path).Str("filesystem", filesystem).Str("volume_id", volumeID).Msg("Formatting")
+
+	_, uuidErr := uuid.Parse(volumeID)
+	identify := uuidErr == nil
 
-	output, err := exec.Command(("mkfs." + filesystem), path).CombinedOutput()
+	// IsFormatted has already refused anything that looks like it holds data, so mkfs doesn't need to ask
+	args := []string{}
+	switch filesystem {
+	case "ext4":
+		args = append(args, "-F")
+		if identify {
+			args = append(args, "-L", FilesystemLabel, "-U", volumeID)
+		}
+	case "xfs":
+		args = append(args, "-f")
+		if identify {
+			args = append(args, "-L", FilesystemLabel, "-m", "uuid="+volumeID)
+		}
+	}
+	args = append(args, path)
+
+	output, err := p.Mounter.Exec.Command("mkfs."+filesystem, args...).CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("formatting with 'mkfs.%s %s' failed: %v output: %s", filesystem, path, err, string(output))
+		return fmt.Errorf("formatting with 'mkfs.%s %s' failed: %v output: %s", filesystem, strings.Join(args, " "), err, string(output))
 	}
 
 	formatted, err := p.IsFormatted(path)
@@ -96,16 +370,41 @@ func (p *RealDiskHotPlugger) Format(path, filesystem string) error {
 		return err
 	}
 	if !formatted {
-		return fmt.Errorf("failed to ensure it was formatted, output of 'mkfs.%s %s' is %s", filesystem, path, string(output))
+		return fmt.Errorf("failed to ensure it was formatted, output of 'mkfs.%s %s' is %s", filesystem, strings.Join(args, " "), string(output))
 	}
 
 	return nil
 }
 
+// FilesystemIdentity returns the UUID and label of the filesystem at the path, both are empty if it has neither
+func (p *RealDiskHotPlugger) FilesystemIdentity(path string) (string, string, error) {
+	args := []string{"-p", "-s", "UUID", "-s", "LABEL", "-o", "export", path}
+	output, err := p.Mounter.Exec.Command("blkid", args...).CombinedOutput()
+	if err != nil {
+		var exitError utilexec.ExitError
+		if errors.As(err, &exitError) && exitError.ExitStatus() == blkidNothingFound {
+			return "", "", nil
+		}
+		return "", "", fmt.Errorf("reading filesystem identity with 'blkid %s' failed: %v output: %s", strings.Join(args, " "), err, string(output))
+	}
+
+	var fsUUID, label string
+	for _, line := range strings.Split(string(output), "\n") {
+		key, value, _ := strings.Cut(strings.TrimSpace(line), "=")
+		switch key {
+		case "UUID":
+			fsUUID = value
+		case "LABEL":
+			label = value
+		}
+	}
+
+	return fsUUID, label, nil
+}
+
 // Mount the path to the mountpoint, specifying the current filesystem and mount flags to use
 func (p *RealDiskHotPlugger) Mount(path, mountpoint, filesystem string, flags ...string) error {
 	log.Debug().Str("path", path).Str("filesystem", filesystem).Str("mountpoint", mountpoint).Msg("Mounting")
-	args := []string{}
 
 	if filesystem == "" {
 		// Bind-mount requires a file to bind to
@@ -129,21 +428,12 @@ func (p *RealDiskHotPlugger) Mount(path, mountpoint, filesystem string, flags ..
 		if err != nil {
 			return fmt.Errorf("creating mountpoint failed: %v", err)
 		}
-		args = append(args, "-t", filesystem)
 	}
 
-	if len(flags) > 0 {
-		args = append(args, "-o", strings.Join(flags, ","))
-	}
+	log.Debug().Str("path", path).Str("mountpoint", mountpoint).Strs("flags", flags).Msg("Mounting device")
 
-	args = append(args, path)
-	args = append(args, mountpoint)
-
-	log.Debug().Str("path", path).Str("mountpoint", mountpoint).Msg("Mounting device")
-
-	output, err := exec.Command("mount", args...).CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("mounting with 'mount %s' failed: %v output: %s", strings.Join(args, " "), err, string(output))
+	if err := p.Mounter.Mount(path, mountpoint, filesystem, flags); err != nil {
+		return err
 	}
 
 	mounted, err := p.IsMounted(mountpoint)
@@ -151,7 +441,7 @@ func (p *RealDiskHotPlugger) Mount(path, mountpoint, filesystem string, flags ..
 		return err
 	}
 	if !mounted {
-		return fmt.Errorf("after apparently successful mounting, still not mounted - mount %s output: %s", strings.Join(args, " "), string(output))
+		return fmt.Errorf("after apparently successful mounting of %s, %s is still not mounted", path, mountpoint)
 	}
 
 	log.Debug().Str("path", path).Str("filesystem", filesystem).Str("mountpoint", mountpoint).Msg("Mounting succeeded")
@@ -162,88 +452,152 @@ func (p *RealDiskHotPlugger) Mount(path, mountpoint, filesystem string, flags ..
 // Unmount unmounts the given mountpoint
 func (p *RealDiskHotPlugger) Unmount(mountpoint string) error {
 	log.Debug().Str("mountpoint", mountpoint).Msg("Unmounting mountpoint")
-	output, err := exec.Command("umount", mountpoint).CombinedOutput()
-	log.Debug().Str("output", string(output)).Msg("Unmounting command output")
-	if err != nil {
+	if err := p.Mounter.Unmount(mountpoint); err != nil {
 		log.Error().Err(err).Str("mountpoint", mountpoint).Msg("Failed to unmount")
-		return fmt.Errorf("unmounting with 'umount %s' failed: %v output: %s", mountpoint, err, string(output))
+		return err
 	}
 
 	return nil
 }
 
-// IsFormatted returns true if the device path is already formatted
+// IsFormatted returns true if the device path is already formatted.
+//
+// It errs on the side of never wiping data: blkid's low-level probing is used so the answer doesn't come from a
+// possibly stale cache, the device must be readable (blkid reports unreadable devices the same way as empty ones)
+// and a disk with a partition table is an error rather than unformatted.
 func (p *RealDiskHotPlugger) IsFormatted(path string) (bool, error) {
 	log.Debug().Str("path", path).Msg("Checking if path is formatted")
 	if path == "" {
 		return false, errors.New("path to check is empty")
 	}
 
-	_, err := exec.LookPath("blkid")
+	device, err := os.Open(path)
 	if err != nil {
-		if err == exec.ErrNotFound {
-			log.Error().Msg("Could not find 'blkid' in $PATH")
-			return false, fmt.Errorf("blkid executable not found in $PATH")
-		}
-		return false, err
+		return false, fmt.Errorf("unable to open device %s to check if it's formatted: %v", path, err)
 	}
+	device.Close()
 
-	args := []string{path}
-
-	cmd := exec.Command("blkid", args...)
-	err = cmd.Run()
+	format, err := p.Mounter.GetDiskFormat(path)
 	if err != nil {
-		exitError, ok := err.(*exec.ExitError)
-		if !ok {
-			log.Error().Err(err).Msg("Unable to determine if device is formatted")
-			return false, fmt.Errorf("is device formatted err: %v cmd: blkid %q", err, args)
-		}
+		log.Error().Err(err).Str("path", path).Msg("Unable to determine if device is formatted")
+		return false, fmt.Errorf("unable to determine if device %s is formatted: %v", path, err)
+	}
 
-		exitCode := exitError.Sys().(syscall.WaitStatus).ExitStatus()
-		if exitCode == BlikidNotFound {
-			log.Debug().Str("path", path).Msg("Path is not formatted")
-			return false, nil
-		}
+	if format == partitionedDiskFormat {
+		log.Error().Str("path", path).Msg("Device has a partition table")
+		return false, fmt.Errorf("device %s has a partition table, refusing to treat it as unformatted", path)
+	}
 
-		log.Error().Err(err).Msg("Unable to determine if device is formatted")
-		return false, fmt.Errorf("is device formatted err: %v cmd: blkid %q", err, args)
+	if format == "" {
+		log.Debug().Str("path", path).Msg("Path is not formatted")
+		return false, nil
 	}
 
-	log.Debug().Str("path", path).Msg("Path is formatted")
+	log.Debug().Str("path", path).Str("filesystem", format).Msg("Path is formatted")
 	return true, nil
 }
 
-// IsMounted returns true if the target has a disk mounted there
+// IsMounted returns true if the target has a disk mounted there. A target that doesn't exist isn't mounted,
+// any other error (such as a corrupted mount) is returned so the caller can decide what to do.
 func (p *RealDiskHotPlugger) IsMounted(path string) (bool, error) {
 	log.Debug().Str("path", path).Msg("Checking if path is mounted")
 	if path == "" {
 		return false, errors.New("path is empty")
 	}
 
-	_, err := exec.LookPath("findmnt")
+	// Unlike IsLikelyNotMountPoint on its own, this also finds bind mounts from the same filesystem
+	notMounted, err := mount.IsNotMountPoint(p.Mounter, path)
 	if err != nil {
-		if err == exec.ErrNotFound {
-			log.Error().Msg("Could not find 'findmnt' in $PATH")
-			return false, fmt.Errorf("findmnt executable not found in $PATH")
+		if os.IsNotExist(err) {
+			log.Debug().Str("path", path).Msg("Path doesn't exist, so is not mounted")
+			return false, nil
 		}
+
+		log.Error().Err(err).Str("path", path).Msg("Unable to determine if path is mounted")
 		return false, err
 	}
 
-	args := []string{"-M", path}
-	out, err := exec.Command("findmnt", args...).CombinedOutput()
+	log.Debug().Str("path", path).Bool("mounted", !notMounted).Msg("Checked if path is mounted")
+
+	return !notMounted, nil
+}
+
+// MountSource returns the canonical path of the device mounted at the target, if several are stacked there it's
+// the one that was mounted last (which is the one that's visible)
+func (p *RealDiskHotPlugger) MountSource(target string) (string, error) {
+	mountPoints, err := p.Mounter.List()
 	if err != nil {
-		if strings.TrimSpace(string(out)) == "" {
-			log.Debug().Str("path", path).Msg("Path is not mounted")
-			return false, nil
+		return "", err
+	}
+
+	resolvedTarget, err := filepath.EvalSymlinks(target)
+	if err != nil {
+		resolvedTarget = target
+	}
+
+	source := ""
+	for _, mp := range mountPoints {
+		if mp.Path == resolvedTarget {
+			source = mp.Device
 		}
+	}
+	if source == "" {
+		return "", nil
+	}
 
-		log.Error().Err(err).Msg("Unable to determine if device is mounted")
-		return false, fmt.Errorf("is device mounted err: %v cmd: findmnt %q", err, args)
+	if resolved, err := filepath.EvalSymlinks(source); err == nil {
+		source = resolved
 	}
 
-	log.Debug().Str("path", path).Msg("Path is mounted")
+	return source, nil
+}
 
-	return true, nil
+// SetVolumeOwnership gives the group ownership of everything in the mounted volume, in the same way kubelet does
+// for a pod's fsGroup: files become group readable and writable and directories are also group executable and
+// setgid, so new files inherit the group. The walk is skipped if the volume's root already matches, as it can take
+// a long time on large volumes (kubelet's OnRootMismatch policy).
+func (p *RealDiskHotPlugger) SetVolumeOwnership(path string, gid int) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Gid) == gid && info.Mode()&ownershipDirMask == ownershipDirMask {
+		log.Debug().Str("path", path).Int("gid", gid).Msg("Volume root already has the right ownership, skipping")
+		return nil
+	}
+
+	log.Info().Str("path", path).Int("gid", gid).Msg("Changing volume ownership")
+
+	return filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if err := os.Lchown(file, -1, gid); err != nil {
+			return fmt.Errorf("changing the group of %s failed: %v", file, err)
+		}
+
+		// Symlinks don't have their own permissions
+		if entry.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		mask := ownershipFileMask
+		if entry.IsDir() {
+			mask = ownershipDirMask
+		}
+
+		if err := os.Chmod(file, info.Mode()|mask); err != nil {
+			return fmt.Errorf("changing the permissions of %s failed: %v", file, err)
+		}
+		return nil
+	})
 }
 
 // GetStatistics returns the statistics for a given volume path.
@@ -268,10 +622,30 @@ func (p *RealDiskHotPlugger) GetStatistics(volumePath string) (VolumeStatistics,
 	return volStats, nil
 }
 
+// Healthy returns an error if the host is missing anything needed to stage volumes
+func (p *RealDiskHotPlugger) Healthy() error {
+	for _, binary := range requiredHostBinaries {
+		if _, err := exec.LookPath(binary); err != nil {
+			return fmt.Errorf("%s executable not found in $PATH: %v", binary, err)
+		}
+	}
+
+	if _, err := os.ReadDir(p.DiskByIDPath); err != nil {
+		return fmt.Errorf("unable to read %s: %v", p.DiskByIDPath, err)
+	}
+
+	return nil
+}
+
 // FakeDiskHotPlugger is a fake implementation of RealDiskHotPlugger
 type FakeDiskHotPlugger struct {
 	DiskAttachmentMissing bool
+	DiskAttachmentDelay   int
+	PathForVolumeCalls    int
+	SettleCalled          bool
 	Filesystem            string
+	FilesystemUUID        string
+	FilesystemLabel       string
 	Formatted             bool
 	FormatCalled          bool
 	ExpandCalled          bool
@@ -279,27 +653,86 @@ type FakeDiskHotPlugger struct {
 	Mountpoint            string
 	Mounted               bool
 	MountCalled           bool
+	MountFlags            []string
+	DeviceSizeBytes       int64
+	RescannedSizeBytes    int64
+	RescanCalled          bool
+	HealthErr             error
+	PreflightErr          error
+	PreflightFilesystems  []string
+	PreflightUdevSettle   bool
+	FormatErr             error
+	MountErr              error
+	PathErr               error
+	CheckCalled           bool
+	CheckErr              error
+	OwnershipPath         string
+	OwnershipGID          int
+
+	// formattedIdentities are the UUID and label of each path the fake has formatted
+	formattedIdentities map[string][2]string
 }
 
-// PathForVolume returns the path of the hotplugged disk
-func (p *FakeDiskHotPlugger) PathForVolume(volumeID string) string {
-	if p.DiskAttachmentMissing {
-		return ""
+// PathForVolume returns the path of the hotplugged disk, reporting it as missing for the first
+// DiskAttachmentDelay calls to simulate udev being slow to create the symlink, or returns PathErr if set
+func (p *FakeDiskHotPlugger) PathForVolume(volumeID string) (string, error) {
+	p.PathForVolumeCalls++
+	if p.PathErr != nil {
+		return "", p.PathErr
+	}
+	if p.DiskAttachmentMissing || p.PathForVolumeCalls <= p.DiskAttachmentDelay {
+		return "", nil
 	}
 
-	return "/fake-dev/disk/by-id/" + volumeID
+	return "/fake-dev/disk/by-id/" + volumeID, nil
 }
 
-// Format erases the path with a new empty filesystem
-func (p *FakeDiskHotPlugger) Format(path, filesystem string) error {
+// SettleDevices records that udev was asked to settle
+func (p *FakeDiskHotPlugger) SettleDevices() error {
+	p.SettleCalled = true
+	return nil
+}
+
+// Format erases the path with a new empty filesystem labelled as belonging to the volume, or returns FormatErr if set
+func (p *FakeDiskHotPlugger) Format(path, filesystem, volumeID string) error {
+	p.FormatCalled = true
+	if p.FormatErr != nil {
+		return p.FormatErr
+	}
 	p.Device = path
 	p.Formatted = true
-	p.FormatCalled = true
+	if p.formattedIdentities == nil {
+		p.formattedIdentities = map[string][2]string{}
+	}
+	p.formattedIdentities[path] = [2]string{volumeID, FilesystemLabel}
+	return nil
+}
+
+// FilesystemIdentity returns the identity the path was formatted with, or FilesystemUUID and FilesystemLabel if
+// the fake didn't format it (as the fake shares its Formatted state between every path)
+func (p *FakeDiskHotPlugger) FilesystemIdentity(path string) (string, string, error) {
+	if identity, ok := p.formattedIdentities[path]; ok {
+		return identity[0], identity[1], nil
+	}
+	return p.FilesystemUUID, p.FilesystemLabel, nil
+}
+
+// DeviceSize returns DeviceSizeBytes
+func (p *FakeDiskHotPlugger) DeviceSize(path string) (int64, error) {
+	return p.DeviceSizeBytes, nil
+}
+
+// RescanDevice records that the disk was rescanned, after which it's RescannedSizeBytes if that's set
+func (p *FakeDiskHotPlugger) RescanDevice(path string) error {
+	p.RescanCalled = true
+	if p.RescannedSizeBytes != 0 {
+		p.DeviceSizeBytes = p.RescannedSizeBytes
+	}
 	return nil
 }
 
 // ExpandFilesystem expands the existing file system at the given path
-func (p *FakeDiskHotPlugger) ExpandFilesystem(path string) error {
+func (p *FakeDiskHotPlugger) ExpandFilesystem(path, mountpoint string) error {
 	if !p.Formatted {
 		return fmt.Errorf("disk must be formatted before being expanded")
 	}
@@ -309,12 +742,25 @@ func (p *FakeDiskHotPlugger) ExpandFilesystem(path string) error {
 	return nil
 }
 
-// Mount the path to the mountpoint, specifying the current filesystem and mount flags to use
+// CheckFilesystem records that the filesystem was checked, returning CheckErr if set
+func (p *FakeDiskHotPlugger) CheckFilesystem(path, filesystem string) error {
+	p.CheckCalled = true
+	return p.CheckErr
+}
+
+// Mount the path to the mountpoint, specifying the current filesystem and mount flags to use, or returns MountErr if set
 func (p *FakeDiskHotPlugger) Mount(path, mountpoint, filesystem string, flags ...string) error {
-	p.Device = path
+	p.MountCalled = true
+	if p.MountErr != nil {
+		return p.MountErr
+	}
+	// A bind mount shows up with the device of the mount it's bound from
+	if !slices.Contains(flags, "bind") {
+		p.Device = path
+	}
 	p.Mountpoint = mountpoint
+	p.MountFlags = flags
 	p.Mounted = true
-	p.MountCalled = true
 	return nil
 }
 
@@ -338,6 +784,21 @@ func (p *FakeDiskHotPlugger) IsMounted(target string) (bool, error) {
 	return p.Mounted, nil
 }
 
+// MountSource returns the device mounted at the target
+func (p *FakeDiskHotPlugger) MountSource(target string) (string, error) {
+	if !p.Mounted || p.Mountpoint != target {
+		return "", nil
+	}
+	return p.Device, nil
+}
+
+// SetVolumeOwnership records the path and group it was called with
+func (p *FakeDiskHotPlugger) SetVolumeOwnership(path string, gid int) error {
+	p.OwnershipPath = path
+	p.OwnershipGID = gid
+	return nil
+}
+
 // GetStatistics returns the statistics for the given volume path
 func (p *FakeDiskHotPlugger) GetStatistics(volumePath string) (VolumeStatistics, error) {
 	return VolumeStatistics{
@@ -350,3 +811,15 @@ func (p *FakeDiskHotPlugger) GetStatistics(volumePath string) (VolumeStatistics,
 		UsedInodes:      7000,
 	}, nil
 }
+
+// Healthy returns HealthErr, so tests can simulate a host missing its tooling
+func (p *FakeDiskHotPlugger) Healthy() error {
+	return p.HealthErr
+}
+
+// Preflight records what it was asked to check and returns PreflightErr, so tests can simulate an incompatible host
+func (p *FakeDiskHotPlugger) Preflight(filesystems []string, udevSettle bool) error {
+	p.PreflightFilesystems = filesystems
+	p.PreflightUdevSettle = udevSettle
+	return p.PreflightErr
+}
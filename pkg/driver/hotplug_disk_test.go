@@ -0,0 +1,409 @@
+package driver_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/civo/civo-csi/pkg/driver"
+	"github.com/stretchr/testify/assert"
+	mount "k8s.io/mount-utils"
+	utilexec "k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+// newTestHotPlugger returns a RealDiskHotPlugger backed by a FakeMounter and a FakeExec that runs the given commands in order
+func newTestHotPlugger(mounter *mount.FakeMounter, commands ...testingexec.FakeCommandAction) (*driver.RealDiskHotPlugger, *testingexec.FakeExec) {
+	fakeExec := &testingexec.FakeExec{CommandScript: commands}
+	return &driver.RealDiskHotPlugger{
+		Mounter: &mount.SafeFormatAndMount{
+			Interface: mounter,
+			Exec:      fakeExec,
+		},
+	}, fakeExec
+}
+
+// fakeCommand returns a command that outputs the given text and exits with the given error
+func fakeCommand(t *testing.T, expectedCommand, output string, err error) testingexec.FakeCommandAction {
+	return func(cmd string, args ...string) utilexec.Cmd {
+		assert.Equal(t, expectedCommand, cmd)
+		return testingexec.InitFakeCmd(&testingexec.FakeCmd{
+			CombinedOutputScript: []testingexec.FakeAction{
+				func() ([]byte, []byte, error) { return []byte(output), nil, err },
+			},
+		}, cmd, args...)
+	}
+}
+
+// fakeDevice creates a file standing in for a block device, as it has to exist to be checked
+func fakeDevice(t *testing.T) string {
+	device := filepath.Join(t.TempDir(), "vdb")
+	assert.Nil(t, os.WriteFile(device, nil, 0o600))
+	return device
+}
+
+func TestRealDiskHotPluggerIsFormatted(t *testing.T) {
+	t.Run("Formatted if blkid finds a filesystem", func(t *testing.T) {
+		p, _ := newTestHotPlugger(mount.NewFakeMounter(nil), fakeCommand(t, "blkid", "TYPE=ext4\n", nil))
+
+		formatted, err := p.IsFormatted(fakeDevice(t))
+		assert.Nil(t, err)
+		assert.True(t, formatted)
+	})
+
+	t.Run("Not formatted if blkid finds nothing", func(t *testing.T) {
+		p, _ := newTestHotPlugger(mount.NewFakeMounter(nil), fakeCommand(t, "blkid", "", testingexec.FakeExitError{Status: 2}))
+
+		formatted, err := p.IsFormatted(fakeDevice(t))
+		assert.Nil(t, err)
+		assert.False(t, formatted)
+	})
+
+	t.Run("Errors if the disk has a partition table", func(t *testing.T) {
+		p, _ := newTestHotPlugger(mount.NewFakeMounter(nil), fakeCommand(t, "blkid", "PTTYPE=gpt\n", nil))
+
+		_, err := p.IsFormatted(fakeDevice(t))
+		assert.ErrorContains(t, err, "partition table")
+	})
+
+	t.Run("Errors without running blkid if the device can't be opened", func(t *testing.T) {
+		p, fakeExec := newTestHotPlugger(mount.NewFakeMounter(nil))
+
+		_, err := p.IsFormatted(filepath.Join(t.TempDir(), "missing"))
+		assert.NotNil(t, err)
+		assert.Equal(t, 0, fakeExec.CommandCalls)
+	})
+}
+
+func TestRealDiskHotPluggerMount(t *testing.T) {
+	t.Run("Mounts the device and reports it as mounted until unmounted", func(t *testing.T) {
+		mounter := mount.NewFakeMounter(nil)
+		p, _ := newTestHotPlugger(mounter)
+		target := filepath.Join(t.TempDir(), "staging")
+
+		mounted, err := p.IsMounted(target)
+		assert.Nil(t, err)
+		assert.False(t, mounted)
+
+		err = p.Mount("/dev/vdb", target, "ext4", "noatime")
+		assert.Nil(t, err)
+		assert.Equal(t, []mount.MountPoint{{Device: "/dev/vdb", Path: target, Type: "ext4", Opts: []string{"noatime"}}}, mounter.MountPoints)
+
+		mounted, err = p.IsMounted(target)
+		assert.Nil(t, err)
+		assert.True(t, mounted)
+
+		err = p.Unmount(target)
+		assert.Nil(t, err)
+
+		mounted, err = p.IsMounted(target)
+		assert.Nil(t, err)
+		assert.False(t, mounted)
+	})
+
+	t.Run("Returns errors other than the path not existing from the mount check", func(t *testing.T) {
+		target := t.TempDir()
+		mounter := mount.NewFakeMounter(nil)
+		mounter.MountCheckErrors = map[string]error{target: errors.New("transport endpoint is not connected")}
+		p, _ := newTestHotPlugger(mounter)
+
+		_, err := p.IsMounted(target)
+		assert.ErrorContains(t, err, "transport endpoint is not connected")
+	})
+}
+
+func TestRealDiskHotPluggerExpandFilesystem(t *testing.T) {
+	t.Run("Grows ext4 filesystems with resize2fs", func(t *testing.T) {
+		device := fakeDevice(t)
+		p, fakeExec := newTestHotPlugger(mount.NewFakeMounter(nil),
+			fakeCommand(t, "blkid", "TYPE=ext4\n", nil),
+			fakeCommand(t, "blkid", "TYPE=ext4\n", nil),
+			fakeCommand(t, "resize2fs", "", nil),
+		)
+
+		err := p.ExpandFilesystem(device, "/mnt/staging")
+		assert.Nil(t, err)
+		assert.Equal(t, 3, fakeExec.CommandCalls)
+	})
+}
+
+func TestRealDiskHotPluggerCheckFilesystem(t *testing.T) {
+	t.Run("Passes if e2fsck corrected the errors it found", func(t *testing.T) {
+		p, _ := newTestHotPlugger(mount.NewFakeMounter(nil), fakeCommand(t, "e2fsck", "fixed", testingexec.FakeExitError{Status: 1}))
+
+		assert.Nil(t, p.CheckFilesystem("/dev/vdb", "ext4"))
+	})
+
+	t.Run("Returns FilesystemCorruptedError with the output if e2fsck left errors", func(t *testing.T) {
+		p, _ := newTestHotPlugger(mount.NewFakeMounter(nil), fakeCommand(t, "e2fsck", "RUN fsck MANUALLY", testingexec.FakeExitError{Status: 4}))
+
+		err := p.CheckFilesystem("/dev/vdb", "ext4")
+		var corrupted *driver.FilesystemCorruptedError
+		assert.True(t, errors.As(err, &corrupted))
+		assert.Equal(t, "RUN fsck MANUALLY", corrupted.Output)
+	})
+
+	t.Run("Returns an operational error if e2fsck couldn't check", func(t *testing.T) {
+		p, _ := newTestHotPlugger(mount.NewFakeMounter(nil), fakeCommand(t, "e2fsck", "", testingexec.FakeExitError{Status: 8}))
+
+		err := p.CheckFilesystem("/dev/vdb", "ext4")
+		var corrupted *driver.FilesystemCorruptedError
+		assert.NotNil(t, err)
+		assert.False(t, errors.As(err, &corrupted))
+	})
+
+	t.Run("Leaves a dirty xfs log to be replayed by mounting", func(t *testing.T) {
+		p, _ := newTestHotPlugger(mount.NewFakeMounter(nil), fakeCommand(t, "xfs_repair", "", testingexec.FakeExitError{Status: 2}))
+
+		assert.Nil(t, p.CheckFilesystem("/dev/vdb", "xfs"))
+	})
+
+	t.Run("Returns FilesystemCorruptedError if xfs_repair found corruption", func(t *testing.T) {
+		p, _ := newTestHotPlugger(mount.NewFakeMounter(nil), fakeCommand(t, "xfs_repair", "agf 0 corrupt", testingexec.FakeExitError{Status: 1}))
+
+		err := p.CheckFilesystem("/dev/vdb", "xfs")
+		var corrupted *driver.FilesystemCorruptedError
+		assert.True(t, errors.As(err, &corrupted))
+	})
+}
+
+func TestRealDiskHotPluggerSettleDevices(t *testing.T) {
+	t.Run("Triggers udev for block devices then waits for it to settle", func(t *testing.T) {
+		p, fakeExec := newTestHotPlugger(mount.NewFakeMounter(nil),
+			fakeCommand(t, "udevadm", "", nil),
+			fakeCommand(t, "udevadm", "", nil),
+		)
+
+		assert.Nil(t, p.SettleDevices())
+		assert.Equal(t, 2, fakeExec.CommandCalls)
+	})
+
+	t.Run("Returns an error if udevadm fails", func(t *testing.T) {
+		p, _ := newTestHotPlugger(mount.NewFakeMounter(nil), fakeCommand(t, "udevadm", "no such file", testingexec.FakeExitError{Status: 1}))
+
+		assert.ErrorContains(t, p.SettleDevices(), "no such file")
+	})
+}
+
+// fakeDiskTree creates /dev, /dev/disk/by-id and /sys/block stand-ins with the given disks (name to serial) and
+// partitions, returning a RealDiskHotPlugger that looks for disks in them
+func fakeDiskTree(t *testing.T, disks map[string]string, partitions ...string) *driver.RealDiskHotPlugger {
+	root := t.TempDir()
+	p, _ := newTestHotPlugger(mount.NewFakeMounter(nil))
+	p.DevPath = filepath.Join(root, "dev")
+	p.DiskByIDPath = filepath.Join(root, "dev", "disk", "by-id")
+	p.SysBlockPath = filepath.Join(root, "sys", "block")
+
+	assert.Nil(t, os.MkdirAll(p.DiskByIDPath, 0o750))
+	for name, serial := range disks {
+		assert.Nil(t, os.WriteFile(filepath.Join(p.DevPath, name), nil, 0o600))
+		assert.Nil(t, os.MkdirAll(filepath.Join(p.SysBlockPath, name), 0o750))
+		assert.Nil(t, os.WriteFile(filepath.Join(p.SysBlockPath, name, "serial"), []byte(serial+"\n"), 0o600))
+	}
+	for _, name := range partitions {
+		assert.Nil(t, os.WriteFile(filepath.Join(p.DevPath, name), nil, 0o600))
+	}
+
+	return p
+}
+
+// linkDisk creates a /dev/disk/by-id symlink to the device
+func linkDisk(t *testing.T, p *driver.RealDiskHotPlugger, link, device string) {
+	assert.Nil(t, os.Symlink(filepath.Join(p.DevPath, device), filepath.Join(p.DiskByIDPath, link)))
+}
+
+func TestRealDiskHotPluggerPathForVolume(t *testing.T) {
+	volumeID := "3d1cbf2a-9d8e-4b53-a1cc-2f2e0b6b6a11"
+
+	t.Run("Resolves the by-id symlink to the canonical device", func(t *testing.T) {
+		p := fakeDiskTree(t, map[string]string{"vdb": volumeID[:20]})
+		linkDisk(t, p, "virtio-"+volumeID[:20], "vdb")
+		linkDisk(t, p, "scsi-0QEMU_QEMU_HARDDISK_"+volumeID, "vdb")
+
+		path, err := p.PathForVolume(volumeID)
+		assert.Nil(t, err)
+		assert.Equal(t, filepath.Join(p.DevPath, "vdb"), path)
+	})
+
+	t.Run("Doesn't match a volume whose ID only shares a suffix", func(t *testing.T) {
+		p := fakeDiskTree(t, map[string]string{"vdb": "other"})
+		linkDisk(t, p, "scsi-0QEMU_QEMU_HARDDISK_x"+volumeID, "vdb")
+
+		path, err := p.PathForVolume(volumeID)
+		assert.Nil(t, err)
+		assert.Equal(t, "", path)
+	})
+
+	t.Run("Ignores partition symlinks", func(t *testing.T) {
+		p := fakeDiskTree(t, map[string]string{"vdb": "other"}, "vdb1")
+		linkDisk(t, p, "scsi-0QEMU_QEMU_HARDDISK_"+volumeID+"-part1", "vdb1")
+		linkDisk(t, p, "wwn-"+volumeID, "vdb1")
+
+		path, err := p.PathForVolume(volumeID)
+		assert.Nil(t, err)
+		assert.Equal(t, "", path)
+	})
+
+	t.Run("Errors listing the candidates if more than one disk matches", func(t *testing.T) {
+		p := fakeDiskTree(t, map[string]string{"vdb": "", "vdc": ""})
+		linkDisk(t, p, "virtio-"+volumeID[:20], "vdb")
+		linkDisk(t, p, "scsi-0QEMU_QEMU_HARDDISK_"+volumeID, "vdc")
+
+		_, err := p.PathForVolume(volumeID)
+		assert.ErrorContains(t, err, filepath.Join(p.DevPath, "vdb"))
+		assert.ErrorContains(t, err, filepath.Join(p.DevPath, "vdc"))
+	})
+
+	t.Run("Falls back to the disk's serial if there's no by-id symlink", func(t *testing.T) {
+		p := fakeDiskTree(t, map[string]string{"vda": "root", "vdb": volumeID[:20]})
+
+		path, err := p.PathForVolume(volumeID)
+		assert.Nil(t, err)
+		assert.Equal(t, filepath.Join(p.DevPath, "vdb"), path)
+	})
+}
+
+func TestRealDiskHotPluggerFormat(t *testing.T) {
+	t.Run("Uses the volume ID as the filesystem UUID and labels it", func(t *testing.T) {
+		volumeID := "3d1cbf2a-9d8e-4b53-a1cc-2f2e0b6b6a11"
+		device := fakeDevice(t)
+		var mkfsArgs []string
+		p, _ := newTestHotPlugger(mount.NewFakeMounter(nil),
+			func(cmd string, args ...string) utilexec.Cmd {
+				mkfsArgs = args
+				return fakeCommand(t, "mkfs.ext4", "", nil)(cmd, args...)
+			},
+			fakeCommand(t, "blkid", "TYPE=ext4\n", nil),
+		)
+
+		assert.Nil(t, p.Format(device, "ext4", volumeID))
+		assert.Equal(t, []string{"-F", "-L", driver.FilesystemLabel, "-U", volumeID, device}, mkfsArgs)
+	})
+
+	t.Run("Doesn't label the filesystem if the volume ID isn't a UUID", func(t *testing.T) {
+		device := fakeDevice(t)
+		var mkfsArgs []string
+		p, _ := newTestHotPlugger(mount.NewFakeMounter(nil),
+			func(cmd string, args ...string) utilexec.Cmd {
+				mkfsArgs = args
+				return fakeCommand(t, "mkfs.xfs", "", nil)(cmd, args...)
+			},
+			fakeCommand(t, "blkid", "TYPE=xfs\n", nil),
+		)
+
+		assert.Nil(t, p.Format(device, "xfs", "volume-1"))
+		assert.Equal(t, []string{"-f", device}, mkfsArgs)
+	})
+}
+
+func TestRealDiskHotPluggerFilesystemIdentity(t *testing.T) {
+	t.Run("Returns the filesystem's UUID and label", func(t *testing.T) {
+		p, _ := newTestHotPlugger(mount.NewFakeMounter(nil), fakeCommand(t, "blkid", "UUID=3d1cbf2a-9d8e-4b53-a1cc-2f2e0b6b6a11\nLABEL=civo-csi\n", nil))
+
+		fsUUID, label, err := p.FilesystemIdentity("/dev/vdb")
+		assert.Nil(t, err)
+		assert.Equal(t, "3d1cbf2a-9d8e-4b53-a1cc-2f2e0b6b6a11", fsUUID)
+		assert.Equal(t, "civo-csi", label)
+	})
+
+	t.Run("Returns nothing if the filesystem has neither", func(t *testing.T) {
+		p, _ := newTestHotPlugger(mount.NewFakeMounter(nil), fakeCommand(t, "blkid", "", testingexec.FakeExitError{Status: 2}))
+
+		fsUUID, label, err := p.FilesystemIdentity("/dev/vdb")
+		assert.Nil(t, err)
+		assert.Equal(t, "", fsUUID)
+		assert.Equal(t, "", label)
+	})
+}
+
+func TestRealDiskHotPluggerMountSource(t *testing.T) {
+	t.Run("Returns the device most recently mounted at the target", func(t *testing.T) {
+		target := t.TempDir()
+		p, _ := newTestHotPlugger(mount.NewFakeMounter([]mount.MountPoint{
+			{Device: "/dev/vdb", Path: target},
+			{Device: "/dev/vdc", Path: target},
+			{Device: "/dev/vdd", Path: "/mnt/elsewhere"},
+		}))
+
+		source, err := p.MountSource(target)
+		assert.Nil(t, err)
+		assert.Equal(t, "/dev/vdc", source)
+	})
+
+	t.Run("Returns nothing if nothing is mounted at the target", func(t *testing.T) {
+		p, _ := newTestHotPlugger(mount.NewFakeMounter(nil))
+
+		source, err := p.MountSource(t.TempDir())
+		assert.Nil(t, err)
+		assert.Equal(t, "", source)
+	})
+}
+
+func TestRealDiskHotPluggerSetVolumeOwnership(t *testing.T) {
+	gid := os.Getgid()
+
+	t.Run("Makes everything in the volume group writable", func(t *testing.T) {
+		p, _ := newTestHotPlugger(mount.NewFakeMounter(nil))
+		volume := t.TempDir()
+		assert.Nil(t, os.Chmod(volume, 0o700))
+		assert.Nil(t, os.Mkdir(filepath.Join(volume, "data"), 0o700))
+		assert.Nil(t, os.WriteFile(filepath.Join(volume, "data", "file"), nil, 0o600))
+
+		assert.Nil(t, p.SetVolumeOwnership(volume, gid))
+
+		info, err := os.Stat(filepath.Join(volume, "data"))
+		assert.Nil(t, err)
+		assert.Equal(t, os.ModeDir|os.ModeSetgid|0o770, info.Mode())
+
+		info, err = os.Stat(filepath.Join(volume, "data", "file"))
+		assert.Nil(t, err)
+		assert.Equal(t, os.FileMode(0o660), info.Mode())
+	})
+
+	t.Run("Skips the volume if its root already has the right ownership", func(t *testing.T) {
+		p, _ := newTestHotPlugger(mount.NewFakeMounter(nil))
+		volume := t.TempDir()
+		assert.Nil(t, os.Chmod(volume, os.ModeSetgid|0o770))
+		assert.Nil(t, os.WriteFile(filepath.Join(volume, "file"), nil, 0o600))
+
+		assert.Nil(t, p.SetVolumeOwnership(volume, gid))
+
+		info, err := os.Stat(filepath.Join(volume, "file"))
+		assert.Nil(t, err)
+		assert.Equal(t, os.FileMode(0o600), info.Mode())
+	})
+}
+
+func TestRealDiskHotPluggerDeviceSize(t *testing.T) {
+	t.Run("Reads the size of the disk from sysfs", func(t *testing.T) {
+		p := fakeDiskTree(t, map[string]string{"vdb": "serial"})
+		linkDisk(t, p, "virtio-serial", "vdb")
+		assert.Nil(t, os.WriteFile(filepath.Join(p.SysBlockPath, "vdb", "size"), []byte("41943040\n"), 0o600))
+
+		size, err := p.DeviceSize(filepath.Join(p.DiskByIDPath, "virtio-serial"))
+		assert.Nil(t, err)
+		assert.Equal(t, 20*driver.BytesInGigabyte, size)
+	})
+}
+
+func TestRealDiskHotPluggerRescanDevice(t *testing.T) {
+	t.Run("Rescans a SCSI disk", func(t *testing.T) {
+		p := fakeDiskTree(t, map[string]string{"sdb": "serial"})
+		rescan := filepath.Join(p.SysBlockPath, "sdb", "device", "rescan")
+		assert.Nil(t, os.MkdirAll(filepath.Dir(rescan), 0o750))
+		assert.Nil(t, os.WriteFile(rescan, nil, 0o600))
+
+		assert.Nil(t, p.RescanDevice(filepath.Join(p.DevPath, "sdb")))
+
+		data, err := os.ReadFile(rescan)
+		assert.Nil(t, err)
+		assert.Equal(t, "1", string(data))
+	})
+
+	t.Run("Does nothing for a disk that can't be rescanned", func(t *testing.T) {
+		p := fakeDiskTree(t, map[string]string{"vdb": "serial"})
+
+		assert.Nil(t, p.RescanDevice(filepath.Join(p.DevPath, "vdb")))
+	})
+}
@@ -15,7 +15,7 @@ func (d *Driver) GetPluginInfo(context.Context, *csi.GetPluginInfoRequest) (*csi
 	log.Info().Msg("Request: GetPluginInfo")
 
 	return &csi.GetPluginInfoResponse{
-		Name:          "csi.civo.com",
+		Name:          DriverName,
 		VendorVersion: Version,
 	}, nil
 }
@@ -33,6 +33,13 @@ func (d *Driver) GetPluginCapabilities(context.Context, *csi.GetPluginCapabiliti
 					},
 				},
 			},
+			{
+				Type: &csi.PluginCapability_Service_{
+					Service: &csi.PluginCapability_Service{
+						Type: csi.PluginCapability_Service_VOLUME_ACCESSIBILITY_CONSTRAINTS,
+					},
+				},
+			},
 			{
 				Type: &csi.PluginCapability_VolumeExpansion_{
 					VolumeExpansion: &csi.PluginCapability_VolumeExpansion{
@@ -44,11 +51,11 @@ func (d *Driver) GetPluginCapabilities(context.Context, *csi.GetPluginCapabiliti
 	}, nil
 }
 
-// Probe is a health check for the driver
-func (d *Driver) Probe(context.Context, *csi.ProbeRequest) (*csi.ProbeResponse, error) {
-	err := d.CivoClient.Ping()
-	if err != nil {
-		return nil, status.Errorf(codes.Unavailable, "unable to connect to Civo API: %s", err)
+// Probe is a health check for the driver, it runs the same checks as the /readyz endpoint so it stays cheap
+// on nodes (which don't need the Civo API to stage volumes)
+func (d *Driver) Probe(ctx context.Context, _ *csi.ProbeRequest) (*csi.ProbeResponse, error) {
+	if _, err := runChecks(ctx, d.readinessChecks()); err != nil {
+		return nil, status.Errorf(codes.Unavailable, "driver is not ready: %s", err)
 	}
 
 	return &csi.ProbeResponse{
@@ -3,6 +3,7 @@ package driver_test
 import (
 	"context"
 	"fmt"
+	"os"
 	"testing"
 
 	"github.com/civo/civo-csi/pkg/driver"
@@ -10,6 +11,8 @@ import (
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/golang/protobuf/ptypes/wrappers"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestProbe(t *testing.T) {
@@ -30,3 +33,33 @@ func TestProbeUnhealthy(t *testing.T) {
 	_, err := d.Probe(context.Background(), &csi.ProbeRequest{})
 	assert.NotNil(t, err)
 }
+
+func TestProbeNodeDoesNotCallCivoAPI(t *testing.T) {
+	fc, _ := civogo.NewFakeClient()
+	fc.PingErr = fmt.Errorf("something went wrong")
+	d, _ := driver.NewTestDriver(fc)
+	d.Mode = driver.ModeNode
+
+	os.Setenv("NODE_ID", "instance-1")
+	os.Setenv("REGION", "TESTING")
+
+	resp, err := d.Probe(context.Background(), &csi.ProbeRequest{})
+	assert.Nil(t, err)
+
+	assert.Equal(t, &wrappers.BoolValue{Value: true}, resp.Ready)
+}
+
+func TestProbeNodeUnhealthyHost(t *testing.T) {
+	fc, _ := civogo.NewFakeClient()
+	d, _ := driver.NewTestDriver(fc)
+	d.Mode = driver.ModeNode
+	d.DiskHotPlugger = &driver.FakeDiskHotPlugger{
+		HealthErr: fmt.Errorf("blkid executable not found in $PATH"),
+	}
+
+	os.Setenv("NODE_ID", "instance-1")
+	os.Setenv("REGION", "TESTING")
+
+	_, err := d.Probe(context.Background(), &csi.ProbeRequest{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
@@ -0,0 +1,58 @@
+package driver
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// metrics are the driver's Prometheus metrics, served in the text exposition format on /metrics by the health server
+type metrics struct {
+	mu sync.Mutex
+
+	orphanScans             int64
+	orphanScanFailures      int64
+	orphanedVolumes         int64
+	orphanedVolumeGigabytes int64
+	orphanedVolumesDeleted  int64
+
+	releasedVolumes           int64
+	softDeletedVolumesDeleted int64
+
+	attachmentReconciles        int64
+	attachmentReconcileFailures int64
+	staleAttachmentsDetached    int64
+}
+
+// metric is a single sample written by writeTo
+type metric struct {
+	name       string
+	metricType string
+	help       string
+	value      int64
+}
+
+// writeTo writes the metrics to w in the Prometheus text exposition format
+func (m *metrics) writeTo(w io.Writer) error {
+	m.mu.Lock()
+	samples := []metric{
+		{"civo_csi_orphan_scans_total", "counter", "Number of scans for orphaned volumes.", m.orphanScans},
+		{"civo_csi_orphan_scan_failures_total", "counter", "Number of scans for orphaned volumes that failed.", m.orphanScanFailures},
+		{"civo_csi_orphaned_volumes", "gauge", "Number of the cluster's Civo volumes without a PersistentVolume at the last scan.", m.orphanedVolumes},
+		{"civo_csi_orphaned_volume_gigabytes", "gauge", "Size of the cluster's Civo volumes without a PersistentVolume at the last scan.", m.orphanedVolumeGigabytes},
+		{"civo_csi_orphaned_volumes_deleted_total", "counter", "Number of orphaned volumes deleted.", m.orphanedVolumesDeleted},
+		{"civo_csi_released_volumes", "gauge", "Number of volumes released instead of being deleted at the last scan for orphaned volumes.", m.releasedVolumes},
+		{"civo_csi_soft_deleted_volumes_deleted_total", "counter", "Number of soft-deleted volumes deleted.", m.softDeletedVolumesDeleted},
+		{"civo_csi_attachment_reconciles_total", "counter", "Number of reconciliations of volume attachments.", m.attachmentReconciles},
+		{"civo_csi_attachment_reconcile_failures_total", "counter", "Number of reconciliations of volume attachments that failed.", m.attachmentReconcileFailures},
+		{"civo_csi_stale_attachments_detached_total", "counter", "Number of volumes detached from instances that were no longer in the cluster.", m.staleAttachmentsDetached},
+	}
+	m.mu.Unlock()
+
+	for _, s := range samples {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", s.name, s.help, s.name, s.metricType, s.name, s.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package driver
+
+import (
+	"fmt"
+	"strings"
+)
+
+// allowedMountFlags are the mount options a PV or StorageClass may set through mountOptions. Options that would
+// let a workload escape the volume (dev, suid) or change how the driver mounts it (bind, remount) aren't allowed.
+var allowedMountFlags = map[string]struct{}{
+	"ro":          {},
+	"rw":          {},
+	"noatime":     {},
+	"nodiratime":  {},
+	"relatime":    {},
+	"strictatime": {},
+	"lazytime":    {},
+	"nolazytime":  {},
+	"nodev":       {},
+	"nosuid":      {},
+	"noexec":      {},
+	"sync":        {},
+	"async":       {},
+	"dirsync":     {},
+	"discard":     {},
+	"nodiscard":   {},
+	"barrier":     {},
+	"nobarrier":   {},
+	"usrquota":    {},
+	"grpquota":    {},
+	"prjquota":    {},
+	"inode64":     {},
+	"largeio":     {},
+	"nolargeio":   {},
+}
+
+// allowedMountFlagPrefixes are mount options that take a value, e.g. commit=60
+var allowedMountFlagPrefixes = []string{
+	"commit=",
+	"data=",
+	"errors=",
+	"allocsize=",
+	"logbufs=",
+	"logbsize=",
+}
+
+// validateMountFlags returns an error listing any of the flags that aren't allowed
+func validateMountFlags(flags []string) error {
+	rejected := []string{}
+
+	for _, flag := range flags {
+		if _, ok := allowedMountFlags[flag]; ok {
+			continue
+		}
+
+		allowed := false
+		for _, prefix := range allowedMountFlagPrefixes {
+			if strings.HasPrefix(flag, prefix) && len(flag) > len(prefix) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			rejected = append(rejected, flag)
+		}
+	}
+
+	if len(rejected) > 0 {
+		return fmt.Errorf("mount options %q aren't supported", rejected)
+	}
+
+	return nil
+}
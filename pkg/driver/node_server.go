@@ -2,20 +2,28 @@ package driver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/rs/zerolog/log"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	v1 "k8s.io/api/core/v1"
 	mount "k8s.io/mount-utils"
 )
 
 // MaxVolumesPerNode is the maximum number of volumes a single node may host
 const MaxVolumesPerNode int64 = 1024
 
+// DeviceWaitInterval is how often staging looks for an attached disk while waiting for it to appear
+const DeviceWaitInterval = 500 * time.Millisecond
+
 // NodeStageVolume is called after the volume is attached to the instance, so it can be partitioned, formatted and mounted to a staging path
 func (d *Driver) NodeStageVolume(ctx context.Context, req *csi.NodeStageVolumeRequest) (*csi.NodeStageVolumeResponse, error) {
 	log.Info().Str("volume_id", req.VolumeId).Str("staging_target_path", req.StagingTargetPath).Msg("Request: NodeStageVolume")
@@ -32,14 +40,19 @@ func (d *Driver) NodeStageVolume(ctx context.Context, req *csi.NodeStageVolumeRe
 		log.Error().Msg("must provide a VolumeCapability to NodeStageVolume")
 		return nil, status.Error(codes.InvalidArgument, "must provide a VolumeCapability to NodeStageVolume")
 	}
+	if err := validateMountFlags(req.VolumeCapability.GetMount().GetMountFlags()); err != nil {
+		log.Error().Str("volume_id", req.VolumeId).Err(err).Msg("Invalid mount options")
+		return nil, status.Errorf(codes.InvalidArgument, "invalid mount options for volume %q: %s", req.VolumeId, err)
+	}
 
-	log.Debug().Str("volume_id", req.VolumeId).Msg("Formatting and mounting volume (staging)")
+	readOnly := readOnlyAccessMode(req.VolumeCapability) || req.PublishContext[PublishContextReadOnly] == "true"
+
+	log.Debug().Str("volume_id", req.VolumeId).Bool("readonly", readOnly).Msg("Formatting and mounting volume (staging)")
 
 	// Find the disk attachment location
-	attachedDiskPath := d.DiskHotPlugger.PathForVolume(req.VolumeId)
-	if attachedDiskPath == "" {
-		log.Error().Str("volume_id", req.VolumeId).Msg("path to volume (/dev/disk/by-id/VOLUME_ID) not found")
-		return nil, status.Errorf(codes.NotFound, "path to volume (/dev/disk/by-id/%s) not found", req.VolumeId)
+	attachedDiskPath, err := d.waitForDevice(ctx, req.VolumeId)
+	if err != nil {
+		return nil, err
 	}
 
 	// Format the volume if not already formatted
@@ -51,29 +64,167 @@ func (d *Driver) NodeStageVolume(ctx context.Context, req *csi.NodeStageVolumeRe
 	log.Debug().Str("volume_id", req.VolumeId).Bool("formatted", formatted).Msg("Is currently formatted?")
 
 	if !formatted {
-		d.DiskHotPlugger.Format(d.DiskHotPlugger.PathForVolume(req.VolumeId), "ext4")
+		// A restored or cloned volume without a filesystem means the copy failed, formatting it would hide that
+		// by handing the workload an empty volume
+		if source := req.VolumeContext[VolumeContextContentSource]; source != "" {
+			log.Error().Str("volume_id", req.VolumeId).Str("content_source", source).Msg("Refusing to format a volume created from a content source")
+			d.recordVolumeEvent(ctx, req.VolumeId, v1.EventTypeWarning, "FormatRefused", "Refusing to format volume %s at %s as it was created from a %s but has no filesystem", req.VolumeId, attachedDiskPath, source)
+			return nil, status.Errorf(codes.FailedPrecondition, "volume %q was created from a %s but has no filesystem, refusing to format it", req.VolumeId, source)
+		}
+		if readOnly {
+			log.Error().Str("volume_id", req.VolumeId).Msg("Refusing to format a read-only volume")
+			d.recordVolumeEvent(ctx, req.VolumeId, v1.EventTypeWarning, "FormatRefused", "Refusing to format volume %s at %s as it's read-only but has no filesystem", req.VolumeId, attachedDiskPath)
+			return nil, status.Errorf(codes.FailedPrecondition, "volume %q is read-only but has no filesystem, refusing to format it", req.VolumeId)
+		}
+
+		if err := d.DiskHotPlugger.Format(attachedDiskPath, "ext4", req.VolumeId); err != nil {
+			log.Error().Str("volume_id", req.VolumeId).Str("path", attachedDiskPath).Err(err).Msg("Failed to format volume")
+			d.recordVolumeEvent(ctx, req.VolumeId, v1.EventTypeWarning, "FormatFailed", "Failed to format volume %s at %s: %s", req.VolumeId, attachedDiskPath, err)
+			return nil, status.Errorf(codes.Internal, "failed to format volume %q at %s: %s", req.VolumeId, attachedDiskPath, err)
+		}
+
+		log.Info().Str("volume_id", req.VolumeId).Str("path", attachedDiskPath).Msg("Formatted volume")
+		d.recordVolumeEvent(ctx, req.VolumeId, v1.EventTypeNormal, "Formatted", "Formatted volume %s at %s with %s", req.VolumeId, attachedDiskPath, "ext4")
+	} else if req.VolumeContext[VolumeContextContentSource] == "" {
+		// Restored and cloned volumes carry the filesystem identity of the volume they were copied from
+		if err := d.verifyFilesystemIdentity(req.VolumeId, attachedDiskPath); err != nil {
+			return nil, err
+		}
 	}
 
 	// Mount the volume if not already mounted
-	mounted, err := d.DiskHotPlugger.IsMounted(d.DiskHotPlugger.PathForVolume(req.VolumeId))
+	mounted, err := d.DiskHotPlugger.IsMounted(req.StagingTargetPath)
 	if err != nil {
-		log.Error().Str("path", attachedDiskPath).Err(err).Msg("Mounted check errored")
+		log.Error().Str("path", req.StagingTargetPath).Err(err).Msg("Mounted check errored")
 		return nil, err
 	}
-	log.Debug().Str("volume_id", req.VolumeId).Bool("mounted", formatted).Msg("Is currently mounted?")
+	log.Debug().Str("volume_id", req.VolumeId).Bool("mounted", mounted).Msg("Is currently mounted?")
 
-	if !mounted {
-		mount := req.VolumeCapability.GetMount()
-		options := []string{}
-		if mount != nil {
-			options = mount.MountFlags
+	if mounted {
+		source, err := d.DiskHotPlugger.MountSource(req.StagingTargetPath)
+		if err != nil {
+			log.Error().Str("path", req.StagingTargetPath).Err(err).Msg("Unable to find what's mounted at the staging path")
+			return nil, status.Errorf(codes.Internal, "unable to find what's mounted at %s: %s", req.StagingTargetPath, err)
+		}
+		if source != attachedDiskPath {
+			log.Error().Str("volume_id", req.VolumeId).Str("path", attachedDiskPath).Str("mounted_source", source).Msg("A different disk is mounted at the staging path")
+			return nil, status.Errorf(codes.AlreadyExists, "staging path %s already has %s mounted, not volume %q's disk %s", req.StagingTargetPath, source, req.VolumeId, attachedDiskPath)
+		}
+	} else {
+		// A freshly formatted filesystem doesn't need checking, and a read-only one mustn't be repaired
+		if fsCheck, _ := strconv.ParseBool(req.VolumeContext[VolumeContextFilesystemCheck]); fsCheck && formatted {
+			if readOnly {
+				log.Info().Str("volume_id", req.VolumeId).Msg("Not checking the filesystem of a read-only volume")
+			} else if err := d.checkFilesystem(ctx, req.VolumeId, attachedDiskPath, "ext4"); err != nil {
+				return nil, err
+			}
+		}
+
+		options := append([]string{}, req.VolumeCapability.GetMount().GetMountFlags()...)
+		if readOnly {
+			// Last, so they win over an "rw" in the volume's mount options
+			options = append(options, readOnlyMountFlags("ext4")...)
+		}
+		if err := d.DiskHotPlugger.Mount(attachedDiskPath, req.StagingTargetPath, "ext4", options...); err != nil {
+			log.Error().Str("volume_id", req.VolumeId).Str("path", attachedDiskPath).Str("staging_target_path", req.StagingTargetPath).Err(err).Msg("Failed to mount volume")
+			return nil, status.Errorf(codes.Internal, "failed to mount volume %q at %s: %s", req.VolumeId, req.StagingTargetPath, err)
 		}
-		d.DiskHotPlugger.Mount(d.DiskHotPlugger.PathForVolume(req.VolumeId), req.StagingTargetPath, "ext4", options...)
 	}
 
 	return &csi.NodeStageVolumeResponse{}, nil
 }
 
+// readOnlyMountFlags returns the mount options that stop the filesystem writing to the disk at all, for ext4
+// that includes not replaying the journal
+func readOnlyMountFlags(filesystem string) []string {
+	if filesystem == "ext4" {
+		return []string{"ro", "noload"}
+	}
+	return []string{"ro"}
+}
+
+// verifyFilesystemIdentity checks that a filesystem the driver formatted belongs to the volume, so a disk that
+// was resolved wrongly is never mounted. Filesystems formatted before the driver labelled them can't be checked.
+func (d *Driver) verifyFilesystemIdentity(volumeID, path string) error {
+	fsUUID, label, err := d.DiskHotPlugger.FilesystemIdentity(path)
+	if err != nil {
+		log.Error().Str("volume_id", volumeID).Str("path", path).Err(err).Msg("Unable to read filesystem identity")
+		return status.Errorf(codes.Internal, "unable to read the filesystem identity of volume %q at %s: %s", volumeID, path, err)
+	}
+
+	if label != FilesystemLabel {
+		log.Debug().Str("volume_id", volumeID).Str("path", path).Str("label", label).Msg("Filesystem wasn't labelled by the driver, unable to verify it")
+		return nil
+	}
+
+	if !strings.EqualFold(fsUUID, volumeID) {
+		log.Error().Str("volume_id", volumeID).Str("path", path).Str("filesystem_uuid", fsUUID).Msg("Disk has the filesystem of a different volume")
+		return status.Errorf(codes.AlreadyExists, "disk %s has the filesystem of volume %q, not %q", path, fsUUID, volumeID)
+	}
+
+	return nil
+}
+
+// waitForDevice waits up to d.DeviceWaitTimeout for the attached disk to appear on the node, as ControllerPublishVolume
+// returns as soon as the Civo API has attached it, which may be before udev has created its symlink
+func (d *Driver) waitForDevice(ctx context.Context, volumeID string) (string, error) {
+	waitCtx, cancel := context.WithTimeout(ctx, d.DeviceWaitTimeout)
+	defer cancel()
+
+	settled := false
+	for {
+		path, err := d.DiskHotPlugger.PathForVolume(volumeID)
+		if err != nil {
+			log.Error().Str("volume_id", volumeID).Err(err).Msg("Unable to find the volume's disk")
+			return "", status.Errorf(codes.FailedPrecondition, "unable to find the disk for volume %q: %s", volumeID, err)
+		}
+		if path != "" {
+			return path, nil
+		}
+
+		// udev may have missed the event (or be slow to process it), so ask it to try again once
+		if d.UdevSettle && !settled {
+			settled = true
+			if err := d.DiskHotPlugger.SettleDevices(); err != nil {
+				log.Warn().Str("volume_id", volumeID).Err(err).Msg("Failed to settle udev")
+			}
+			continue
+		}
+
+		log.Debug().Str("volume_id", volumeID).Msg("Waiting for volume to appear")
+
+		select {
+		case <-waitCtx.Done():
+			if ctx.Err() != nil {
+				return "", status.FromContextError(ctx.Err()).Err()
+			}
+			log.Error().Str("volume_id", volumeID).Dur("timeout", d.DeviceWaitTimeout).Msg("path to volume (/dev/disk/by-id/VOLUME_ID) not found")
+			return "", status.Errorf(codes.NotFound, "path to volume (/dev/disk/by-id/%s) not found after waiting %s", volumeID, d.DeviceWaitTimeout)
+		case <-time.After(DeviceWaitInterval):
+		}
+	}
+}
+
+// checkFilesystem checks the filesystem before it's staged, returning FailedPrecondition if it needs repairing by
+// hand (with the checker's output, so the operator knows what's wrong) or Internal if the check couldn't be run
+func (d *Driver) checkFilesystem(ctx context.Context, volumeID, path, filesystem string) error {
+	err := d.DiskHotPlugger.CheckFilesystem(path, filesystem)
+	if err == nil {
+		return nil
+	}
+
+	var corrupted *FilesystemCorruptedError
+	if errors.As(err, &corrupted) {
+		log.Error().Str("volume_id", volumeID).Str("path", path).Str("output", corrupted.Output).Msg("Filesystem needs to be repaired manually")
+		d.recordVolumeEvent(ctx, volumeID, v1.EventTypeWarning, "FilesystemCorrupted", "The %s filesystem on volume %s needs to be repaired manually: %s", filesystem, volumeID, corrupted.Output)
+		return status.Errorf(codes.FailedPrecondition, "filesystem on volume %q needs to be repaired manually: %s", volumeID, err)
+	}
+
+	log.Error().Str("volume_id", volumeID).Str("path", path).Err(err).Msg("Failed to check filesystem")
+	d.recordVolumeEvent(ctx, volumeID, v1.EventTypeWarning, "FilesystemCheckFailed", "Failed to check the %s filesystem on volume %s: %s", filesystem, volumeID, err)
+	return status.Errorf(codes.Internal, "failed to check filesystem on volume %q at %s: %s", volumeID, path, err)
+}
+
 // NodeUnstageVolume unmounts the volume when it's finished with, ready for deletion
 func (d *Driver) NodeUnstageVolume(ctx context.Context, req *csi.NodeUnstageVolumeRequest) (*csi.NodeUnstageVolumeResponse, error) {
 	log.Info().Str("volume_id", req.VolumeId).Str("staging_target_path", req.StagingTargetPath).Msg("Request: NodeUnstageVolume")
@@ -127,6 +278,21 @@ func (d *Driver) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolu
 		log.Error().Msg("must provide a VolumeCapability to NodePublishVolume")
 		return nil, status.Error(codes.InvalidArgument, "must provide a VolumeCapability to NodePublishVolume")
 	}
+	mountCapability := req.VolumeCapability.GetMount()
+	readOnly := req.Readonly || readOnlyAccessMode(req.VolumeCapability) || req.PublishContext[PublishContextReadOnly] == "true"
+	if err := validateMountFlags(mountCapability.GetMountFlags()); err != nil {
+		log.Error().Str("volume_id", req.VolumeId).Err(err).Msg("Invalid mount options")
+		return nil, status.Errorf(codes.InvalidArgument, "invalid mount options for volume %q: %s", req.VolumeId, err)
+	}
+	volumeMountGroup := -1
+	if group := mountCapability.GetVolumeMountGroup(); group != "" {
+		gid, err := strconv.Atoi(group)
+		if err != nil || gid < 0 {
+			log.Error().Str("volume_id", req.VolumeId).Str("volume_mount_group", group).Msg("Invalid volume mount group")
+			return nil, status.Errorf(codes.InvalidArgument, "volume mount group %q for volume %q must be a group ID", group, req.VolumeId)
+		}
+		volumeMountGroup = gid
+	}
 
 	log.Debug().Str("volume_id", req.VolumeId).Str("from_path", req.StagingTargetPath).Str("to_path", req.TargetPath).Msg("Bind-mounting volume (publishing)")
 
@@ -146,13 +312,26 @@ func (d *Driver) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolu
 	log.Debug().Str("volume_id", req.VolumeId).Bool("mounted", mounted).Msg("Checking if currently mounting")
 
 	if !mounted {
+		// kubelet delegates the pod's fsGroup to the driver (VOLUME_MOUNT_GROUP), rather than walking the volume
+		// itself. A read-only volume can't be changed, kubelet doesn't change those either.
+		if volumeMountGroup >= 0 && !readOnly {
+			if err := d.DiskHotPlugger.SetVolumeOwnership(req.StagingTargetPath, volumeMountGroup); err != nil {
+				log.Error().Str("volume_id", req.VolumeId).Int("gid", volumeMountGroup).Err(err).Msg("Failed to change volume ownership")
+				return nil, status.Errorf(codes.Internal, "failed to give group %d ownership of volume %q: %s", volumeMountGroup, req.VolumeId, err)
+			}
+		}
+
 		options := []string{
 			"bind",
 		}
-		if req.Readonly {
+		options = append(options, mountCapability.GetMountFlags()...)
+		if readOnly {
 			options = append(options, "ro")
 		}
-		d.DiskHotPlugger.Mount(req.StagingTargetPath, req.TargetPath, "ext4", options...)
+		if err := d.DiskHotPlugger.Mount(req.StagingTargetPath, req.TargetPath, "ext4", options...); err != nil {
+			log.Error().Str("volume_id", req.VolumeId).Str("staging_target_path", req.StagingTargetPath).Str("target_path", req.TargetPath).Err(err).Msg("Failed to bind-mount volume")
+			return nil, status.Errorf(codes.Internal, "failed to bind-mount volume %q at %s: %s", req.VolumeId, req.TargetPath, err)
+		}
 	}
 
 	return &csi.NodePublishVolumeResponse{}, nil
@@ -218,7 +397,7 @@ func (d *Driver) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpublish
 func (d *Driver) NodeGetInfo(ctx context.Context, req *csi.NodeGetInfoRequest) (*csi.NodeGetInfoResponse, error) {
 	log.Info().Msg("Request: NodeGetInfo")
 
-	nodeInstanceID, region, err := d.currentNodeDetails()
+	nodeInstanceID, region, err := d.nodeDetails()
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to get current node details")
 		return nil, status.Errorf(codes.Internal, "failed to get current node details: %s", err)
@@ -233,7 +412,7 @@ func (d *Driver) NodeGetInfo(ctx context.Context, req *csi.NodeGetInfoRequest) (
 		// make sure that the driver works on this particular region only
 		AccessibleTopology: &csi.Topology{
 			Segments: map[string]string{
-				"region": region,
+				TopologyRegionKey: region,
 			},
 		},
 	}, nil
@@ -305,28 +484,83 @@ func (d *Driver) NodeExpandVolume(ctx context.Context, req *csi.NodeExpandVolume
 		return nil, status.Error(codes.InvalidArgument, "must provide a VolumePath to NodeExpandVolume")
 	}
 
-	_, err := d.CivoClient.GetVolume(req.VolumeId)
+	// Only a mounted volume can be grown, kubelet never asks to grow anything else
+	mounted, err := d.DiskHotPlugger.IsMounted(req.VolumePath)
 	if err != nil {
-		log.Error().Str("volume_id", req.VolumeId).Err(err).Msg("Failed to find VolumeID to NodeExpandVolume")
-		return nil, status.Errorf(codes.NotFound, "unable to find VolumeID %q to NodeExpandVolume: %s", req.VolumeId, err)
+		log.Error().Str("path", req.VolumePath).Err(err).Msg("Mounted check errored")
+		return nil, status.Errorf(codes.Internal, "unable to check whether %s is mounted: %s", req.VolumePath, err)
 	}
+	if !mounted {
+		log.Error().Str("volume_id", req.VolumeId).Str("path", req.VolumePath).Msg("Volume isn't mounted at the volume path")
+		return nil, status.Errorf(codes.NotFound, "volume %q isn't mounted at %s", req.VolumeId, req.VolumePath)
+	}
+
 	// Find the disk attachment location
-	attachedDiskPath := d.DiskHotPlugger.PathForVolume(req.VolumeId)
+	attachedDiskPath, err := d.DiskHotPlugger.PathForVolume(req.VolumeId)
+	if err != nil {
+		log.Error().Str("volume_id", req.VolumeId).Err(err).Msg("Unable to find the volume's disk")
+		return nil, status.Errorf(codes.FailedPrecondition, "unable to find the disk for volume %q: %s", req.VolumeId, err)
+	}
 	if attachedDiskPath == "" {
 		log.Error().Str("volume_id", req.VolumeId).Msg("path to volume (/dev/disk/by-id/VOLUME_ID) not found")
 		return nil, status.Errorf(codes.NotFound, "path to volume (/dev/disk/by-id/%s) not found", req.VolumeId)
 	}
 
-	log.Info().Str("volume_id", req.VolumeId).Str("path", attachedDiskPath).Msg("Expanding Volume")
-	err = d.DiskHotPlugger.ExpandFilesystem(d.DiskHotPlugger.PathForVolume(req.VolumeId))
+	// A disk that's detached and reattached while it's mounted leaves the mount on the old, gone device
+	source, err := d.DiskHotPlugger.MountSource(req.VolumePath)
+	if err != nil {
+		log.Error().Str("path", req.VolumePath).Err(err).Msg("Unable to find what's mounted at the volume path")
+		return nil, status.Errorf(codes.Internal, "unable to find what's mounted at %s: %s", req.VolumePath, err)
+	}
+	if source != "" && source != attachedDiskPath {
+		log.Error().Str("volume_id", req.VolumeId).Str("path", attachedDiskPath).Str("mounted_source", source).Msg("Volume was reattached while mounted")
+		return nil, status.Errorf(codes.FailedPrecondition, "volume %q is mounted from %s but its disk is now %s, it must be unmounted and staged again to grow it", req.VolumeId, source, attachedDiskPath)
+	}
+
+	size, err := d.grownDeviceSize(req.VolumeId, attachedDiskPath, req.GetCapacityRange().GetRequiredBytes())
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().Str("volume_id", req.VolumeId).Str("path", attachedDiskPath).Int64("size_bytes", size).Msg("Expanding Volume")
+	err = d.DiskHotPlugger.ExpandFilesystem(attachedDiskPath, req.VolumePath)
 	if err != nil {
 		log.Error().Str("volume_id", req.VolumeId).Err(err).Msg("Failed to expand filesystem")
 		return nil, status.Errorf(codes.Internal, "failed to expand file system: %s", err)
 	}
 
-	// TODO: Get new size for resposne
+	return &csi.NodeExpandVolumeResponse{CapacityBytes: size}, nil
+}
 
-	return &csi.NodeExpandVolumeResponse{}, nil
+// grownDeviceSize returns the size of the volume's disk, once it's at least the required size. The kernel may not
+// have noticed the disk was resized, so it's rescanned once if it looks too small.
+func (d *Driver) grownDeviceSize(volumeID, path string, requiredBytes int64) (int64, error) {
+	size, err := d.DiskHotPlugger.DeviceSize(path)
+	if err != nil {
+		log.Error().Str("volume_id", volumeID).Str("path", path).Err(err).Msg("Unable to read the size of the disk")
+		return 0, status.Errorf(codes.Internal, "unable to read the size of disk %s for volume %q: %s", path, volumeID, err)
+	}
+	if size >= requiredBytes {
+		return size, nil
+	}
+
+	log.Info().Str("volume_id", volumeID).Str("path", path).Int64("size_bytes", size).Int64("required_bytes", requiredBytes).Msg("Disk is smaller than required, rescanning it")
+	if err := d.DiskHotPlugger.RescanDevice(path); err != nil {
+		log.Error().Str("volume_id", volumeID).Str("path", path).Err(err).Msg("Unable to rescan the disk")
+		return 0, status.Errorf(codes.Internal, "unable to rescan disk %s for volume %q: %s", path, volumeID, err)
+	}
+
+	size, err = d.DiskHotPlugger.DeviceSize(path)
+	if err != nil {
+		log.Error().Str("volume_id", volumeID).Str("path", path).Err(err).Msg("Unable to read the size of the disk")
+		return 0, status.Errorf(codes.Internal, "unable to read the size of disk %s for volume %q: %s", path, volumeID, err)
+	}
+	if size < requiredBytes {
+		log.Error().Str("volume_id", volumeID).Str("path", path).Int64("size_bytes", size).Int64("required_bytes", requiredBytes).Msg("Disk hasn't grown")
+		return 0, status.Errorf(codes.FailedPrecondition, "disk %s for volume %q is %d bytes, it hasn't grown to the %d bytes required", path, volumeID, size, requiredBytes)
+	}
+
+	return size, nil
 }
 
 // NodeGetCapabilities returns the capabilities that this node and driver support
@@ -355,6 +589,13 @@ func (d *Driver) NodeGetCapabilities(ctx context.Context, req *csi.NodeGetCapabi
 					},
 				},
 			},
+			{
+				Type: &csi.NodeServiceCapability_Rpc{
+					Rpc: &csi.NodeServiceCapability_RPC{
+						Type: csi.NodeServiceCapability_RPC_VOLUME_MOUNT_GROUP,
+					},
+				},
+			},
 		},
 	}, nil
 }
@@ -366,6 +607,28 @@ type civostatsdConfig struct {
 	InstanceID string `toml:"instance_id"`
 }
 
+// nodeDetails returns the current node's instance ID and region, only resolving them the first time they're
+// successfully found
+func (d *Driver) nodeDetails() (string, string, error) {
+	d.nodeDetailsMu.Lock()
+	defer d.nodeDetailsMu.Unlock()
+
+	if d.nodeInstanceID != "" {
+		return d.nodeInstanceID, d.nodeRegion, nil
+	}
+
+	instanceID, region, err := d.currentNodeDetails()
+	if err != nil {
+		return "", "", err
+	}
+	if instanceID == "" {
+		return "", "", fmt.Errorf("unable to determine the instance ID of the current node")
+	}
+
+	d.nodeInstanceID, d.nodeRegion = instanceID, region
+	return instanceID, region, nil
+}
+
 func (d *Driver) currentNodeDetails() (string, string, error) {
 	configFile := "/etc/civostatsd"
 
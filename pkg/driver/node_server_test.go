@@ -2,9 +2,11 @@ package driver_test
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path"
 	"testing"
+	"time"
 
 	"github.com/civo/civo-csi/pkg/driver"
 	"github.com/civo/civogo"
@@ -12,6 +14,10 @@ import (
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
 )
 
 func TestNodeStageVolume(t *testing.T) {
@@ -85,6 +91,568 @@ func TestNodeStageVolume(t *testing.T) {
 
 		assert.Equal(t, status.Code(err), codes.NotFound)
 	})
+
+	t.Run("Waits for the disk to appear", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+		d.DeviceWaitTimeout = 5 * time.Second
+
+		hotPlugger := &driver.FakeDiskHotPlugger{
+			DiskAttachmentDelay: 2,
+		}
+		d.DiskHotPlugger = hotPlugger
+
+		_, err := d.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+			VolumeId:          "volume-1",
+			StagingTargetPath: "/mnt/my-target",
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		})
+		assert.Nil(t, err)
+
+		assert.Equal(t, 3, hotPlugger.PathForVolumeCalls)
+		assert.False(t, hotPlugger.SettleCalled)
+		assert.True(t, hotPlugger.MountCalled)
+	})
+
+	t.Run("Settles udev once if enabled and the disk hasn't appeared", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+		d.UdevSettle = true
+
+		hotPlugger := &driver.FakeDiskHotPlugger{
+			DiskAttachmentDelay: 1,
+		}
+		d.DiskHotPlugger = hotPlugger
+
+		_, err := d.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+			VolumeId:          "volume-1",
+			StagingTargetPath: "/mnt/my-target",
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		})
+		assert.Nil(t, err)
+
+		assert.True(t, hotPlugger.SettleCalled)
+		assert.Equal(t, 2, hotPlugger.PathForVolumeCalls)
+	})
+
+	t.Run("Stops waiting for the disk when the request is cancelled", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+		d.DeviceWaitTimeout = time.Minute
+
+		hotPlugger := &driver.FakeDiskHotPlugger{
+			DiskAttachmentMissing: true,
+		}
+		d.DiskHotPlugger = hotPlugger
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		_, err := d.NodeStageVolume(ctx, &csi.NodeStageVolumeRequest{
+			VolumeId:          "volume-1",
+			StagingTargetPath: "/mnt/my-target",
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		})
+
+		assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	})
+
+	t.Run("Returns FailedPrecondition gRPC error if the disk can't be identified", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+
+		hotPlugger := &driver.FakeDiskHotPlugger{
+			PathErr: fmt.Errorf("found 2 disks for volume volume-1"),
+		}
+		d.DiskHotPlugger = hotPlugger
+
+		_, err := d.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+			VolumeId:          "volume-1",
+			StagingTargetPath: "/mnt/my-target",
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		})
+
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+		assert.False(t, hotPlugger.FormatCalled)
+		assert.False(t, hotPlugger.MountCalled)
+	})
+
+	t.Run("Returns Internal gRPC error and doesn't mount if formatting fails", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+
+		hotPlugger := &driver.FakeDiskHotPlugger{
+			FormatErr: fmt.Errorf("mkfs.ext4 failed"),
+		}
+		d.DiskHotPlugger = hotPlugger
+
+		_, err := d.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+			VolumeId:          "volume-1",
+			StagingTargetPath: "/mnt/my-target",
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		})
+
+		assert.Equal(t, codes.Internal, status.Code(err))
+		assert.Contains(t, err.Error(), "mkfs.ext4 failed")
+		assert.False(t, hotPlugger.MountCalled)
+	})
+
+	t.Run("Returns Internal gRPC error if mounting fails", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+
+		hotPlugger := &driver.FakeDiskHotPlugger{
+			MountErr: fmt.Errorf("mount failed"),
+		}
+		d.DiskHotPlugger = hotPlugger
+
+		_, err := d.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+			VolumeId:          "volume-1",
+			StagingTargetPath: "/mnt/my-target",
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		})
+
+		assert.Equal(t, codes.Internal, status.Code(err))
+		assert.Contains(t, err.Error(), "mount failed")
+
+		mounted, _ := d.DiskHotPlugger.IsMounted("/mnt/my-target")
+		assert.False(t, mounted)
+	})
+
+	t.Run("Records an event against the PersistentVolume when formatting", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+
+		recorder := record.NewFakeRecorder(10)
+		d.EventRecorder = recorder
+		d.KubeClient = fake.NewSimpleClientset(&v1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pvc-1"},
+			Spec: v1.PersistentVolumeSpec{
+				PersistentVolumeSource: v1.PersistentVolumeSource{
+					CSI: &v1.CSIPersistentVolumeSource{
+						Driver:       driver.DriverName,
+						VolumeHandle: "volume-1",
+					},
+				},
+			},
+		})
+
+		_, err := d.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+			VolumeId:          "volume-1",
+			StagingTargetPath: "/mnt/my-target",
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		})
+		assert.Nil(t, err)
+
+		assert.Len(t, recorder.Events, 1)
+		assert.Contains(t, <-recorder.Events, "Normal Formatted Formatted volume volume-1")
+	})
+
+	t.Run("Refuses to format a volume created from a snapshot", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+
+		hotPlugger := &driver.FakeDiskHotPlugger{}
+		d.DiskHotPlugger = hotPlugger
+
+		_, err := d.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+			VolumeId:          "volume-1",
+			StagingTargetPath: "/mnt/my-target",
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+			VolumeContext: map[string]string{
+				driver.VolumeContextContentSource: "snapshot",
+			},
+		})
+
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+		assert.False(t, hotPlugger.FormatCalled)
+		assert.False(t, hotPlugger.MountCalled)
+	})
+
+	t.Run("Does not mount again if already mounted at the staging path", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+
+		hotPlugger := &driver.FakeDiskHotPlugger{
+			Formatted:  true,
+			Device:     "/fake-dev/disk/by-id/volume-1",
+			Mounted:    true,
+			Mountpoint: "/mnt/my-target",
+		}
+		d.DiskHotPlugger = hotPlugger
+
+		_, err := d.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+			VolumeId:          "volume-1",
+			StagingTargetPath: "/mnt/my-target",
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		})
+		assert.Nil(t, err)
+
+		assert.False(t, hotPlugger.MountCalled)
+	})
+
+	t.Run("Returns AlreadyExists gRPC error if a different disk is mounted at the staging path", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+
+		hotPlugger := &driver.FakeDiskHotPlugger{
+			Formatted:  true,
+			Device:     "/fake-dev/disk/by-id/volume-2",
+			Mounted:    true,
+			Mountpoint: "/mnt/my-target",
+		}
+		d.DiskHotPlugger = hotPlugger
+
+		_, err := d.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+			VolumeId:          "volume-1",
+			StagingTargetPath: "/mnt/my-target",
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		})
+
+		assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	})
+
+	t.Run("Labels the filesystem with the volume ID when formatting", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+
+		hotPlugger := &driver.FakeDiskHotPlugger{}
+		d.DiskHotPlugger = hotPlugger
+
+		_, err := d.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+			VolumeId:          "volume-1",
+			StagingTargetPath: "/mnt/my-target",
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		})
+		assert.Nil(t, err)
+
+		fsUUID, label, _ := hotPlugger.FilesystemIdentity("/fake-dev/disk/by-id/volume-1")
+		assert.Equal(t, "volume-1", fsUUID)
+		assert.Equal(t, driver.FilesystemLabel, label)
+	})
+
+	t.Run("Returns AlreadyExists gRPC error if the disk has another volume's filesystem", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+
+		hotPlugger := &driver.FakeDiskHotPlugger{
+			Formatted:       true,
+			FilesystemUUID:  "volume-2",
+			FilesystemLabel: driver.FilesystemLabel,
+		}
+		d.DiskHotPlugger = hotPlugger
+
+		_, err := d.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+			VolumeId:          "volume-1",
+			StagingTargetPath: "/mnt/my-target",
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		})
+
+		assert.Equal(t, codes.AlreadyExists, status.Code(err))
+		assert.False(t, hotPlugger.MountCalled)
+	})
+
+	t.Run("Stages filesystems that weren't labelled by the driver or were copied from another volume", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+
+		for _, tc := range []struct {
+			hotPlugger    *driver.FakeDiskHotPlugger
+			volumeContext map[string]string
+		}{
+			{
+				hotPlugger: &driver.FakeDiskHotPlugger{Formatted: true, FilesystemUUID: "3d1cbf2a-9d8e-4b53-a1cc-2f2e0b6b6a11"},
+			},
+			{
+				hotPlugger:    &driver.FakeDiskHotPlugger{Formatted: true, FilesystemUUID: "volume-2", FilesystemLabel: driver.FilesystemLabel},
+				volumeContext: map[string]string{driver.VolumeContextContentSource: "snapshot"},
+			},
+		} {
+			d.DiskHotPlugger = tc.hotPlugger
+
+			_, err := d.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+				VolumeId:          "volume-1",
+				StagingTargetPath: "/mnt/my-target",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				VolumeContext: tc.volumeContext,
+			})
+			assert.Nil(t, err)
+			assert.True(t, tc.hotPlugger.MountCalled)
+		}
+	})
+
+	t.Run("Checks the filesystem before mounting if enabled", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+
+		hotPlugger := &driver.FakeDiskHotPlugger{
+			Formatted: true,
+		}
+		d.DiskHotPlugger = hotPlugger
+
+		_, err := d.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+			VolumeId:          "volume-1",
+			StagingTargetPath: "/mnt/my-target",
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+			VolumeContext: map[string]string{
+				driver.VolumeContextFilesystemCheck: "true",
+			},
+		})
+		assert.Nil(t, err)
+
+		assert.True(t, hotPlugger.CheckCalled)
+		assert.True(t, hotPlugger.MountCalled)
+	})
+
+	t.Run("Does not check the filesystem unless enabled or if just formatted", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+
+		hotPlugger := &driver.FakeDiskHotPlugger{
+			Formatted: true,
+		}
+		d.DiskHotPlugger = hotPlugger
+
+		_, err := d.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+			VolumeId:          "volume-1",
+			StagingTargetPath: "/mnt/my-target",
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		})
+		assert.Nil(t, err)
+		assert.False(t, hotPlugger.CheckCalled)
+
+		hotPlugger = &driver.FakeDiskHotPlugger{}
+		d.DiskHotPlugger = hotPlugger
+
+		_, err = d.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+			VolumeId:          "volume-1",
+			StagingTargetPath: "/mnt/my-target",
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+			VolumeContext: map[string]string{
+				driver.VolumeContextFilesystemCheck: "true",
+			},
+		})
+		assert.Nil(t, err)
+		assert.True(t, hotPlugger.FormatCalled)
+		assert.False(t, hotPlugger.CheckCalled)
+	})
+
+	t.Run("Returns FailedPrecondition with the check output if the filesystem needs manual repair", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+
+		hotPlugger := &driver.FakeDiskHotPlugger{
+			Formatted: true,
+			CheckErr: &driver.FilesystemCorruptedError{
+				Path:       "/fake-dev/disk/by-id/volume-1",
+				Filesystem: "ext4",
+				Output:     "UNEXPECTED INCONSISTENCY; RUN fsck MANUALLY.",
+			},
+		}
+		d.DiskHotPlugger = hotPlugger
+
+		_, err := d.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+			VolumeId:          "volume-1",
+			StagingTargetPath: "/mnt/my-target",
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+			VolumeContext: map[string]string{
+				driver.VolumeContextFilesystemCheck: "true",
+			},
+		})
+
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+		assert.Contains(t, err.Error(), "RUN fsck MANUALLY")
+		assert.False(t, hotPlugger.MountCalled)
+	})
+
+	t.Run("Mounts read-only access modes without replaying the journal", func(t *testing.T) {
+		d, _ := driver.NewTestDriver(nil)
+
+		hotPlugger := &driver.FakeDiskHotPlugger{
+			Formatted: true,
+		}
+		d.DiskHotPlugger = hotPlugger
+
+		_, err := d.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+			VolumeId:          "volume-1",
+			StagingTargetPath: "/mnt/my-target",
+			VolumeContext: map[string]string{
+				driver.VolumeContextFilesystemCheck: "true",
+			},
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{
+					Mount: &csi.VolumeCapability_MountVolume{
+						MountFlags: []string{"rw", "noatime"},
+					},
+				},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY,
+				},
+			},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"rw", "noatime", "ro", "noload"}, hotPlugger.MountFlags)
+		assert.False(t, hotPlugger.CheckCalled)
+	})
+
+	t.Run("Mounts volumes attached read-only as read-only", func(t *testing.T) {
+		d, _ := driver.NewTestDriver(nil)
+
+		hotPlugger := &driver.FakeDiskHotPlugger{
+			Formatted: true,
+		}
+		d.DiskHotPlugger = hotPlugger
+
+		_, err := d.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+			VolumeId:          "volume-1",
+			StagingTargetPath: "/mnt/my-target",
+			PublishContext: map[string]string{
+				driver.PublishContextReadOnly: "true",
+			},
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"ro", "noload"}, hotPlugger.MountFlags)
+	})
+
+	t.Run("Refuses to format a read-only volume", func(t *testing.T) {
+		d, _ := driver.NewTestDriver(nil)
+
+		hotPlugger := &driver.FakeDiskHotPlugger{}
+		d.DiskHotPlugger = hotPlugger
+
+		_, err := d.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+			VolumeId:          "volume-1",
+			StagingTargetPath: "/mnt/my-target",
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY,
+				},
+			},
+		})
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+		assert.False(t, hotPlugger.FormatCalled)
+		assert.False(t, hotPlugger.MountCalled)
+	})
+
+	t.Run("Returns Internal gRPC error if the filesystem check can't be run", func(t *testing.T) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+
+		hotPlugger := &driver.FakeDiskHotPlugger{
+			Formatted: true,
+			CheckErr:  fmt.Errorf("running e2fsck failed"),
+		}
+		d.DiskHotPlugger = hotPlugger
+
+		_, err := d.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+			VolumeId:          "volume-1",
+			StagingTargetPath: "/mnt/my-target",
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+			VolumeContext: map[string]string{
+				driver.VolumeContextFilesystemCheck: "true",
+			},
+		})
+
+		assert.Equal(t, codes.Internal, status.Code(err))
+		assert.False(t, hotPlugger.MountCalled)
+	})
 }
 
 func TestNodeUnstageVolume(t *testing.T) {
@@ -137,6 +705,164 @@ func TestNodePublishVolume(t *testing.T) {
 		mounted, _ := d.DiskHotPlugger.IsMounted(targetPath)
 		assert.True(t, mounted)
 	})
+
+	t.Run("Returns Internal gRPC error if the bind-mount fails", func(t *testing.T) {
+		d, _ := driver.NewTestDriver(nil)
+
+		hotPlugger := &driver.FakeDiskHotPlugger{
+			MountErr: fmt.Errorf("mount failed"),
+		}
+		d.DiskHotPlugger = hotPlugger
+
+		targetPath := path.Join(t.TempDir(), "some-path")
+
+		_, err := d.NodePublishVolume(context.Background(), &csi.NodePublishVolumeRequest{
+			VolumeId:          "volume-1",
+			StagingTargetPath: "/mnt/my-target",
+			TargetPath:        targetPath,
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		})
+
+		assert.Equal(t, codes.Internal, status.Code(err))
+		assert.Contains(t, err.Error(), "mount failed")
+	})
+
+	t.Run("Bind-mounts with the volume's mount options", func(t *testing.T) {
+		d, _ := driver.NewTestDriver(nil)
+
+		hotPlugger := &driver.FakeDiskHotPlugger{}
+		d.DiskHotPlugger = hotPlugger
+
+		_, err := d.NodePublishVolume(context.Background(), &csi.NodePublishVolumeRequest{
+			VolumeId:          "volume-1",
+			StagingTargetPath: "/mnt/my-target",
+			TargetPath:        path.Join(t.TempDir(), "some-path"),
+			Readonly:          true,
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{
+					Mount: &csi.VolumeCapability_MountVolume{
+						MountFlags: []string{"noatime", "nosuid"},
+					},
+				},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"bind", "noatime", "nosuid", "ro"}, hotPlugger.MountFlags)
+	})
+
+	t.Run("Returns InvalidArgument gRPC error for mount options that aren't allowed", func(t *testing.T) {
+		d, _ := driver.NewTestDriver(nil)
+
+		hotPlugger := &driver.FakeDiskHotPlugger{}
+		d.DiskHotPlugger = hotPlugger
+
+		_, err := d.NodePublishVolume(context.Background(), &csi.NodePublishVolumeRequest{
+			VolumeId:          "volume-1",
+			StagingTargetPath: "/mnt/my-target",
+			TargetPath:        path.Join(t.TempDir(), "some-path"),
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{
+					Mount: &csi.VolumeCapability_MountVolume{
+						MountFlags: []string{"noatime", "suid"},
+					},
+				},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		assert.Contains(t, err.Error(), "suid")
+		assert.False(t, hotPlugger.MountCalled)
+	})
+
+	t.Run("Gives the volume mount group ownership of the volume", func(t *testing.T) {
+		d, _ := driver.NewTestDriver(nil)
+
+		hotPlugger := &driver.FakeDiskHotPlugger{}
+		d.DiskHotPlugger = hotPlugger
+
+		_, err := d.NodePublishVolume(context.Background(), &csi.NodePublishVolumeRequest{
+			VolumeId:          "volume-1",
+			StagingTargetPath: "/mnt/my-target",
+			TargetPath:        path.Join(t.TempDir(), "some-path"),
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{
+					Mount: &csi.VolumeCapability_MountVolume{
+						VolumeMountGroup: "2000",
+					},
+				},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, "/mnt/my-target", hotPlugger.OwnershipPath)
+		assert.Equal(t, 2000, hotPlugger.OwnershipGID)
+	})
+
+	t.Run("Returns InvalidArgument gRPC error if the volume mount group isn't a group ID", func(t *testing.T) {
+		d, _ := driver.NewTestDriver(nil)
+
+		hotPlugger := &driver.FakeDiskHotPlugger{}
+		d.DiskHotPlugger = hotPlugger
+
+		_, err := d.NodePublishVolume(context.Background(), &csi.NodePublishVolumeRequest{
+			VolumeId:          "volume-1",
+			StagingTargetPath: "/mnt/my-target",
+			TargetPath:        path.Join(t.TempDir(), "some-path"),
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{
+					Mount: &csi.VolumeCapability_MountVolume{
+						VolumeMountGroup: "staff",
+					},
+				},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		assert.Equal(t, "", hotPlugger.OwnershipPath)
+	})
+
+	t.Run("Bind-mounts volumes attached read-only as read-only without changing their ownership", func(t *testing.T) {
+		d, _ := driver.NewTestDriver(nil)
+
+		hotPlugger := &driver.FakeDiskHotPlugger{}
+		d.DiskHotPlugger = hotPlugger
+
+		_, err := d.NodePublishVolume(context.Background(), &csi.NodePublishVolumeRequest{
+			VolumeId:          "volume-1",
+			StagingTargetPath: "/mnt/my-target",
+			TargetPath:        path.Join(t.TempDir(), "some-path"),
+			PublishContext: map[string]string{
+				driver.PublishContextReadOnly: "true",
+			},
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{
+					Mount: &csi.VolumeCapability_MountVolume{
+						VolumeMountGroup: "2000",
+					},
+				},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"bind", "ro"}, hotPlugger.MountFlags)
+		assert.Equal(t, "", hotPlugger.OwnershipPath)
+	})
 }
 
 func TestNodeUnpublishVolume(t *testing.T) {
@@ -163,6 +889,110 @@ func TestNodeUnpublishVolume(t *testing.T) {
 	})
 }
 
+func TestNodeExpandVolume(t *testing.T) {
+	t.Run("Grows the filesystem on the volume's disk and returns its size", func(t *testing.T) {
+		d, _ := driver.NewTestDriver(nil)
+
+		hotPlugger := &driver.FakeDiskHotPlugger{
+			Formatted:       true,
+			Mounted:         true,
+			Device:          "/fake-dev/disk/by-id/volume-1",
+			Mountpoint:      "/mnt/my-target",
+			DeviceSizeBytes: 20 * driver.BytesInGigabyte,
+		}
+		d.DiskHotPlugger = hotPlugger
+
+		resp, err := d.NodeExpandVolume(context.Background(), &csi.NodeExpandVolumeRequest{
+			VolumeId:      "volume-1",
+			VolumePath:    "/mnt/my-target",
+			CapacityRange: &csi.CapacityRange{RequiredBytes: 20 * driver.BytesInGigabyte},
+		})
+		assert.Nil(t, err)
+		assert.True(t, hotPlugger.ExpandCalled)
+		assert.False(t, hotPlugger.RescanCalled)
+		assert.Equal(t, 20*driver.BytesInGigabyte, resp.CapacityBytes)
+	})
+
+	t.Run("Rescans the disk if the kernel hasn't noticed it grew", func(t *testing.T) {
+		d, _ := driver.NewTestDriver(nil)
+
+		hotPlugger := &driver.FakeDiskHotPlugger{
+			Formatted:          true,
+			Mounted:            true,
+			Device:             "/fake-dev/disk/by-id/volume-1",
+			Mountpoint:         "/mnt/my-target",
+			DeviceSizeBytes:    10 * driver.BytesInGigabyte,
+			RescannedSizeBytes: 20 * driver.BytesInGigabyte,
+		}
+		d.DiskHotPlugger = hotPlugger
+
+		resp, err := d.NodeExpandVolume(context.Background(), &csi.NodeExpandVolumeRequest{
+			VolumeId:      "volume-1",
+			VolumePath:    "/mnt/my-target",
+			CapacityRange: &csi.CapacityRange{RequiredBytes: 20 * driver.BytesInGigabyte},
+		})
+		assert.Nil(t, err)
+		assert.True(t, hotPlugger.RescanCalled)
+		assert.Equal(t, 20*driver.BytesInGigabyte, resp.CapacityBytes)
+	})
+
+	t.Run("Returns FailedPrecondition gRPC error if the disk hasn't grown", func(t *testing.T) {
+		d, _ := driver.NewTestDriver(nil)
+
+		hotPlugger := &driver.FakeDiskHotPlugger{
+			Formatted:       true,
+			Mounted:         true,
+			Device:          "/fake-dev/disk/by-id/volume-1",
+			Mountpoint:      "/mnt/my-target",
+			DeviceSizeBytes: 10 * driver.BytesInGigabyte,
+		}
+		d.DiskHotPlugger = hotPlugger
+
+		_, err := d.NodeExpandVolume(context.Background(), &csi.NodeExpandVolumeRequest{
+			VolumeId:      "volume-1",
+			VolumePath:    "/mnt/my-target",
+			CapacityRange: &csi.CapacityRange{RequiredBytes: 20 * driver.BytesInGigabyte},
+		})
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+		assert.False(t, hotPlugger.ExpandCalled)
+	})
+
+	t.Run("Returns NotFound gRPC error if the volume isn't mounted at the path", func(t *testing.T) {
+		d, _ := driver.NewTestDriver(nil)
+
+		hotPlugger := &driver.FakeDiskHotPlugger{
+			Formatted: true,
+		}
+		d.DiskHotPlugger = hotPlugger
+
+		_, err := d.NodeExpandVolume(context.Background(), &csi.NodeExpandVolumeRequest{
+			VolumeId:   "volume-1",
+			VolumePath: "/mnt/my-target",
+		})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+		assert.False(t, hotPlugger.ExpandCalled)
+	})
+
+	t.Run("Returns FailedPrecondition gRPC error if the disk was reattached while mounted", func(t *testing.T) {
+		d, _ := driver.NewTestDriver(nil)
+
+		hotPlugger := &driver.FakeDiskHotPlugger{
+			Formatted:  true,
+			Mounted:    true,
+			Device:     "/dev/vdb",
+			Mountpoint: "/mnt/my-target",
+		}
+		d.DiskHotPlugger = hotPlugger
+
+		_, err := d.NodeExpandVolume(context.Background(), &csi.NodeExpandVolumeRequest{
+			VolumeId:   "volume-1",
+			VolumePath: "/mnt/my-target",
+		})
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+		assert.False(t, hotPlugger.ExpandCalled)
+	})
+}
+
 func TestNodeGetInfo(t *testing.T) {
 	t.Run("Find out the instance ID", func(t *testing.T) {
 		fc, _ := civogo.NewFakeClient()
@@ -0,0 +1,249 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/civo/civogo"
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultOrphanGracePeriod is how long a volume must have been orphaned before it's deleted
+const DefaultOrphanGracePeriod = 24 * time.Hour
+
+// orphanMinimumAge gives the provisioner time to create the PersistentVolume of a volume that's just been created
+const orphanMinimumAge = 5 * time.Minute
+
+// OrphanDeletion describes what happens to volumes that have been orphaned for longer than the grace period
+type OrphanDeletion string
+
+const (
+	// OrphanDeletionOff only reports orphaned volumes
+	OrphanDeletionOff OrphanDeletion = "off"
+	// OrphanDeletionDryRun reports the orphaned volumes that would be deleted, without deleting them
+	OrphanDeletionDryRun OrphanDeletion = "dry-run"
+	// OrphanDeletionOn deletes orphaned volumes
+	OrphanDeletionOn OrphanDeletion = "on"
+)
+
+// ParseOrphanDeletion converts a string (e.g. from a command line flag) into an OrphanDeletion
+func ParseOrphanDeletion(s string) (OrphanDeletion, error) {
+	switch o := OrphanDeletion(s); o {
+	case OrphanDeletionOff, OrphanDeletionDryRun, OrphanDeletionOn:
+		return o, nil
+	}
+	return "", fmt.Errorf("unknown orphan deletion %q, must be one of %q, %q or %q", s, OrphanDeletionOff, OrphanDeletionDryRun, OrphanDeletionOn)
+}
+
+// runOrphanCollector looks for orphaned volumes every OrphanScanInterval until the context is cancelled
+func (d *Driver) runOrphanCollector(ctx context.Context) error {
+	log.Info().Dur("interval", d.OrphanScanInterval).Dur("grace_period", d.OrphanGracePeriod).Str("deletion", string(d.OrphanDeletion)).Msg("Looking for orphaned volumes")
+
+	ticker := time.NewTicker(d.OrphanScanInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Debug().Msg("Stopping the orphaned volume collector because the context was cancelled")
+			return nil
+		case <-ticker.C:
+			if err := d.CollectOrphanedVolumes(ctx); err != nil {
+				log.Error().Err(err).Msg("Unable to collect orphaned volumes")
+			}
+		}
+	}
+}
+
+// CollectOrphanedVolumes finds the cluster's Civo volumes that don't have a PersistentVolume, which are left behind if
+// a PVC is deleted while the controller is down or DeleteVolume keeps failing. Other Civo accounts are only searched
+// if a PV or released volume names a secret for them. Each one is reported with a metric and
+// an event, and once it's been orphaned for longer than the grace period it's deleted if OrphanDeletion is on.
+// Attached volumes and volumes still being created are never deleted. Volumes DeleteVolume released instead of
+// deleting aren't orphaned, soft-deleted ones are deleted once they've been released for long enough.
+func (d *Driver) CollectOrphanedVolumes(ctx context.Context) error {
+	d.metrics.mu.Lock()
+	d.metrics.orphanScans++
+	d.metrics.mu.Unlock()
+
+	scan, err := d.findUnclaimedVolumes(ctx)
+	if err != nil {
+		d.metrics.mu.Lock()
+		d.metrics.orphanScanFailures++
+		d.metrics.mu.Unlock()
+		return err
+	}
+
+	now := time.Now()
+
+	remainingReleased := d.collectReleasedVolumes(ctx, scan, now)
+	d.metrics.mu.Lock()
+	d.metrics.releasedVolumes = int64(remainingReleased)
+	d.metrics.mu.Unlock()
+
+	orphans := []scannedVolume{}
+	for _, volume := range scan.unclaimed {
+		if _, ok := scan.released[volume.ID]; !ok {
+			orphans = append(orphans, volume)
+		}
+	}
+	var orphanedGB int64
+
+	d.orphansMu.Lock()
+	defer d.orphansMu.Unlock()
+
+	firstSeen := map[string]time.Time{}
+	for _, volume := range orphans {
+		orphanedGB += int64(volume.SizeGigabytes)
+
+		seen, ok := d.orphansFirstSeen[volume.ID]
+		if !ok {
+			seen = now
+			log.Warn().Str("volume_id", volume.ID).Str("name", volume.Name).Int("size_gb", volume.SizeGigabytes).Msg("Volume has no PersistentVolume")
+			d.recordVolumeEvent(ctx, volume.ID, v1.EventTypeWarning, "OrphanedVolume", "Volume %s (%s, %dGB) belongs to the cluster but has no PersistentVolume", volume.ID, volume.Name, volume.SizeGigabytes)
+		}
+		firstSeen[volume.ID] = seen
+
+		if now.Sub(seen) < d.OrphanGracePeriod || d.OrphanDeletion == OrphanDeletionOff {
+			continue
+		}
+
+		if volume.InstanceID != "" {
+			log.Warn().Str("volume_id", volume.ID).Str("instance_id", volume.InstanceID).Msg("Not deleting orphaned volume as it's attached")
+			continue
+		}
+
+		if d.OrphanDeletion == OrphanDeletionDryRun {
+			log.Info().Str("volume_id", volume.ID).Str("name", volume.Name).Time("orphaned_since", seen).Msg("Would delete orphaned volume (dry run)")
+			continue
+		}
+
+		log.Info().Str("volume_id", volume.ID).Str("name", volume.Name).Time("orphaned_since", seen).Msg("Deleting orphaned volume")
+		if _, err := volume.client.DeleteVolume(volume.ID); err != nil {
+			log.Error().Err(err).Str("volume_id", volume.ID).Msg("Unable to delete orphaned volume in Civo API")
+			continue
+		}
+		d.recordVolumeEvent(ctx, volume.ID, v1.EventTypeNormal, "OrphanedVolumeDeleted", "Deleted volume %s (%s, %dGB) as it had no PersistentVolume since %s", volume.ID, volume.Name, volume.SizeGigabytes, seen.Format(time.RFC3339))
+		delete(firstSeen, volume.ID)
+		orphanedGB -= int64(volume.SizeGigabytes)
+
+		d.metrics.mu.Lock()
+		d.metrics.orphanedVolumesDeleted++
+		d.metrics.mu.Unlock()
+	}
+
+	// Volumes that have a PersistentVolume again, or have been deleted, start their grace period again if they're
+	// ever orphaned
+	d.orphansFirstSeen = firstSeen
+
+	d.metrics.mu.Lock()
+	d.metrics.orphanedVolumes = int64(len(firstSeen))
+	d.metrics.orphanedVolumeGigabytes = orphanedGB
+	d.metrics.mu.Unlock()
+
+	return nil
+}
+
+// scannedVolume is a Civo volume the orphaned volume collector found, with the client for the account it's in
+type scannedVolume struct {
+	civogo.Volume
+	client civogo.Clienter
+}
+
+// volumeScan is what the orphaned volume collector found in the Civo accounts the cluster's volumes are in
+type volumeScan struct {
+	// unclaimed are the cluster's volumes that aren't the volume handle of any PersistentVolume, by ID
+	unclaimed map[string]scannedVolume
+	// released are the volumes recorded as released, by ID
+	released map[string]releasedVolume
+	// failed are the accounts whose volumes couldn't be listed, by the secretRefKey of their secret
+	failed map[string]bool
+}
+
+// findUnclaimedVolumes returns the cluster's Civo volumes that aren't the volume handle of any of this driver's
+// PersistentVolumes, ignoring volumes that are still being created or were only just created, and the volumes
+// recorded as released. The controller's own account is searched, and the accounts of the secrets named by the PVs
+// and released volumes. Another account whose volumes can't be listed is skipped and recorded as failed, so its
+// released volumes aren't forgotten.
+func (d *Driver) findUnclaimedVolumes(ctx context.Context) (*volumeScan, error) {
+	if d.ClusterID == "" {
+		return nil, errors.New("orphaned volumes can't be found without a cluster ID")
+	}
+	if d.KubeClient == nil {
+		return nil, errors.New("orphaned volumes can't be found without a Kubernetes API client")
+	}
+
+	// List the volumes first, so the PV of any volume that's listed has had as long as possible to be created
+	volumes, err := d.CivoClient.ListVolumes()
+	if err != nil {
+		return nil, fmt.Errorf("list volumes: %w", err)
+	}
+
+	pvs, err := d.KubeClient.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list PersistentVolumes: %w", err)
+	}
+
+	released, err := d.releasedVolumes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The secrets of the other accounts to search, by secretRefKey
+	refs := map[string]*v1.SecretReference{}
+	handles := map[string]struct{}{}
+	for i, pv := range pvs.Items {
+		if pv.Spec.CSI != nil && pv.Spec.CSI.Driver == DriverName {
+			handles[pv.Spec.CSI.VolumeHandle] = struct{}{}
+			if ref := persistentVolumeSecretRef(&pvs.Items[i]); ref != nil {
+				refs[secretRefKey(ref)] = ref
+			}
+		}
+	}
+	for _, rv := range released {
+		if rv.SecretRef != nil {
+			refs[secretRefKey(rv.SecretRef)] = rv.SecretRef
+		}
+	}
+
+	scan := &volumeScan{unclaimed: map[string]scannedVolume{}, released: released, failed: map[string]bool{}}
+	addUnclaimed := func(account *civoAccount, volumes []civogo.Volume) {
+		for _, volume := range volumes {
+			if volume.ClusterID != d.ClusterID {
+				continue
+			}
+			if _, ok := handles[volume.ID]; ok {
+				continue
+			}
+			if account.quotaReservations.reserved(volume.Name) || time.Since(volume.CreatedAt) < orphanMinimumAge {
+				continue
+			}
+			scan.unclaimed[volume.ID] = scannedVolume{Volume: volume, client: account.client}
+		}
+	}
+
+	account, err := d.civoAccount(nil)
+	if err != nil {
+		return nil, err
+	}
+	addUnclaimed(account, volumes)
+
+	for key, ref := range refs {
+		account, err := d.secretCivoAccount(ctx, ref)
+		if err == nil {
+			volumes, err = account.client.ListVolumes()
+		}
+		if err != nil {
+			log.Error().Err(err).Str("secret", key).Msg("Unable to list the volumes in a secret's Civo account")
+			scan.failed[key] = true
+			continue
+		}
+		addUnclaimed(account, volumes)
+	}
+
+	return scan, nil
+}
@@ -0,0 +1,181 @@
+package driver_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/civo/civo-csi/pkg/driver"
+	"github.com/civo/civogo"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCollectOrphanedVolumes(t *testing.T) {
+	// newDriver returns a driver whose cluster has a volume with a PV, two orphaned volumes (one of them attached),
+	// another cluster's volume and a volume created a moment ago
+	newDriver := func() (*driver.Driver, *civogo.FakeClient) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+		fc.Volumes = []civogo.Volume{
+			{ID: "vol-pv", Name: "pvc-1", ClusterID: d.ClusterID, SizeGigabytes: 10},
+			{ID: "vol-orphan", Name: "pvc-2", ClusterID: d.ClusterID, SizeGigabytes: 20},
+			{ID: "vol-attached", Name: "pvc-3", ClusterID: d.ClusterID, SizeGigabytes: 5, InstanceID: "i-12345678", Status: "attached"},
+			{ID: "vol-other", Name: "pvc-4", ClusterID: "another-cluster", SizeGigabytes: 10},
+			{ID: "vol-new", Name: "pvc-5", ClusterID: d.ClusterID, SizeGigabytes: 10, CreatedAt: time.Now()},
+		}
+		d.KubeClient = fake.NewSimpleClientset(&v1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pvc-1"},
+			Spec: v1.PersistentVolumeSpec{
+				PersistentVolumeSource: v1.PersistentVolumeSource{
+					CSI: &v1.CSIPersistentVolumeSource{
+						Driver:       driver.DriverName,
+						VolumeHandle: "vol-pv",
+					},
+				},
+			},
+		})
+		return d, fc
+	}
+
+	volumeIDs := func(fc *civogo.FakeClient) []string {
+		ids := []string{}
+		for _, v := range fc.Volumes {
+			ids = append(ids, v.ID)
+		}
+		return ids
+	}
+
+	metrics := func(d *driver.Driver) string {
+		rec := httptest.NewRecorder()
+		d.HealthHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		return rec.Body.String()
+	}
+
+	t.Run("Reports orphaned volumes without deleting them", func(t *testing.T) {
+		d, fc := newDriver()
+		d.OrphanGracePeriod = 0
+
+		err := d.CollectOrphanedVolumes(context.Background())
+		assert.Nil(t, err)
+
+		assert.Len(t, fc.Volumes, 5)
+		assert.Contains(t, metrics(d), "civo_csi_orphaned_volumes 2\n")
+		assert.Contains(t, metrics(d), "civo_csi_orphaned_volume_gigabytes 25\n")
+	})
+
+	t.Run("Only pretends to delete orphaned volumes in a dry run", func(t *testing.T) {
+		d, fc := newDriver()
+		d.OrphanGracePeriod = 0
+		d.OrphanDeletion = driver.OrphanDeletionDryRun
+
+		err := d.CollectOrphanedVolumes(context.Background())
+		assert.Nil(t, err)
+
+		assert.Len(t, fc.Volumes, 5)
+		assert.Contains(t, metrics(d), "civo_csi_orphaned_volumes_deleted_total 0\n")
+	})
+
+	t.Run("Deletes detached volumes orphaned for longer than the grace period", func(t *testing.T) {
+		d, fc := newDriver()
+		d.OrphanGracePeriod = 0
+		d.OrphanDeletion = driver.OrphanDeletionOn
+
+		err := d.CollectOrphanedVolumes(context.Background())
+		assert.Nil(t, err)
+
+		assert.ElementsMatch(t, []string{"vol-pv", "vol-attached", "vol-other", "vol-new"}, volumeIDs(fc))
+		assert.Contains(t, metrics(d), "civo_csi_orphaned_volumes 1\n")
+		assert.Contains(t, metrics(d), "civo_csi_orphaned_volumes_deleted_total 1\n")
+	})
+
+	t.Run("Waits for the grace period before deleting", func(t *testing.T) {
+		d, fc := newDriver()
+		d.OrphanGracePeriod = time.Hour
+		d.OrphanDeletion = driver.OrphanDeletionOn
+
+		for i := 0; i < 2; i++ {
+			err := d.CollectOrphanedVolumes(context.Background())
+			assert.Nil(t, err)
+		}
+
+		assert.Len(t, fc.Volumes, 5)
+		assert.Contains(t, metrics(d), "civo_csi_orphan_scans_total 2\n")
+	})
+
+	t.Run("Deletes orphaned volumes in the accounts of the PVs' secrets", func(t *testing.T) {
+		d, fc := newDriver()
+		d.OrphanGracePeriod = 0
+		d.OrphanDeletion = driver.OrphanDeletionOn
+
+		teamA, _ := civogo.NewFakeClient()
+		teamA.Volumes = []civogo.Volume{
+			{ID: "vol-team-a", Name: "pvc-6", ClusterID: d.ClusterID, SizeGigabytes: 10},
+			{ID: "vol-team-a-orphan", Name: "pvc-7", ClusterID: d.ClusterID, SizeGigabytes: 10},
+		}
+		d.NewCivoClient = func(apiKey, apiURL, region string) (civogo.Clienter, error) {
+			return teamA, nil
+		}
+		d.KubeClient = fake.NewSimpleClientset(
+			&v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "team-a", Namespace: "kube-system"},
+				Data:       map[string][]byte{driver.SecretAPIKey: []byte("team-a-key")},
+			},
+			&v1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{Name: "pvc-1"},
+				Spec: v1.PersistentVolumeSpec{
+					PersistentVolumeSource: v1.PersistentVolumeSource{
+						CSI: &v1.CSIPersistentVolumeSource{Driver: driver.DriverName, VolumeHandle: "vol-pv"},
+					},
+				},
+			},
+			&v1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{Name: "pvc-6"},
+				Spec: v1.PersistentVolumeSpec{
+					PersistentVolumeSource: v1.PersistentVolumeSource{
+						CSI: &v1.CSIPersistentVolumeSource{
+							Driver:                     driver.DriverName,
+							VolumeHandle:               "vol-team-a",
+							ControllerPublishSecretRef: &v1.SecretReference{Name: "team-a", Namespace: "kube-system"},
+						},
+					},
+				},
+			},
+		)
+
+		err := d.CollectOrphanedVolumes(context.Background())
+		assert.Nil(t, err)
+
+		assert.ElementsMatch(t, []string{"vol-pv", "vol-attached", "vol-other", "vol-new"}, volumeIDs(fc))
+		assert.ElementsMatch(t, []string{"vol-team-a"}, volumeIDs(teamA))
+		assert.Contains(t, metrics(d), "civo_csi_orphaned_volumes_deleted_total 2\n")
+	})
+
+	t.Run("Fails without a Kubernetes API client", func(t *testing.T) {
+		d, fc := newDriver()
+		d.KubeClient = nil
+		d.OrphanGracePeriod = 0
+		d.OrphanDeletion = driver.OrphanDeletionOn
+
+		err := d.CollectOrphanedVolumes(context.Background())
+		assert.NotNil(t, err)
+
+		assert.Len(t, fc.Volumes, 5)
+		assert.Contains(t, metrics(d), "civo_csi_orphan_scan_failures_total 1\n")
+	})
+}
+
+func TestParseOrphanDeletion(t *testing.T) {
+	for _, s := range []string{"off", "dry-run", "on"} {
+		deletion, err := driver.ParseOrphanDeletion(s)
+		assert.Nil(t, err)
+		assert.Equal(t, driver.OrphanDeletion(s), deletion)
+	}
+
+	_, err := driver.ParseOrphanDeletion("yes")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,82 @@
+package driver
+
+// StorageClass parameters understood by the driver, which are passed to CreateVolume
+const (
+	// ParameterFilesystemCheck enables checking (and for ext4, automatically repairing) the filesystem before
+	// it's mounted on the node, set it to "true" to enable it
+	ParameterFilesystemCheck = "csi.civo.com/fs-check"
+
+	// ParameterDetachUnusedToResize lets the driver detach a volume the Civo API still has attached to resize it, as
+	// the Civo API can only resize detached volumes, once nothing in Kubernetes is using it. Set it to "true" to enable
+	// it. It's not online expansion, a volume that's in use is never detached.
+	ParameterDetachUnusedToResize = "csi.civo.com/detach-unused-to-resize"
+
+	// ParameterVolumeType is the Civo volume type to create volumes as, the cluster's volume type if it's not set
+	ParameterVolumeType = "csi.civo.com/volume-type"
+
+	// ParameterDeletionPolicy is what DeleteVolume does with the Civo volume, one of the DeletionPolicy values,
+	// "delete" if it's not set
+	ParameterDeletionPolicy = "csi.civo.com/deletion-policy"
+
+	// ParameterSoftDeleteDays is how many days a volume with the "soft-delete" deletion policy is kept for after
+	// it's released, DefaultSoftDeleteDays if it's not set
+	ParameterSoftDeleteDays = "csi.civo.com/soft-delete-days"
+)
+
+// Parameters external-provisioner adds to the StorageClass's parameters when it's run with --extra-create-metadata
+const (
+	// ParameterPVCName is the name of the PersistentVolumeClaim the volume is being created for
+	ParameterPVCName = "csi.storage.k8s.io/pvc/name"
+
+	// ParameterPVCNamespace is the namespace of the PersistentVolumeClaim the volume is being created for
+	ParameterPVCNamespace = "csi.storage.k8s.io/pvc/namespace"
+
+	// ParameterPVName is the name of the PersistentVolume that will be created for the volume
+	ParameterPVName = "csi.storage.k8s.io/pv/name"
+)
+
+// Keys the driver sets in (and reads from) a volume's VolumeContext, which Kubernetes stores in the PV's
+// spec.csi.volumeAttributes and passes to the node with every stage and publish call
+const (
+	// VolumeContextContentSource records whether a volume was restored from a "snapshot" or cloned from another
+	// "volume", such volumes must never be formatted on the node. It must only be set once the Civo volume has
+	// really been created from the source, CreateVolume rejects content sources until the Civo API supports them.
+	VolumeContextContentSource = "csi.civo.com/content-source"
+
+	// VolumeContextFilesystemCheck is "true" if the filesystem should be checked before it's staged, copied from
+	// the StorageClass's ParameterFilesystemCheck
+	VolumeContextFilesystemCheck = "csi.civo.com/fs-check"
+
+	// VolumeContextDetachUnusedToResize is "true" if the volume may be detached to resize it, copied from the
+	// StorageClass's ParameterDetachUnusedToResize
+	VolumeContextDetachUnusedToResize = "csi.civo.com/detach-unused-to-resize"
+
+	// VolumeContextAdopt is set to "true" in the volumeAttributes of a hand-written PV for an existing Civo volume,
+	// so the driver checks the volume can be used by the cluster before attaching it
+	VolumeContextAdopt = "csi.civo.com/adopt"
+
+	// VolumeContextDeletionPolicy is the volume's deletion policy, copied from the StorageClass's
+	// ParameterDeletionPolicy, it can also be set on a hand-written PV
+	VolumeContextDeletionPolicy = "csi.civo.com/deletion-policy"
+
+	// VolumeContextSoftDeleteDays is how many days a soft-deleted volume is kept for, copied from the
+	// StorageClass's ParameterSoftDeleteDays
+	VolumeContextSoftDeleteDays = "csi.civo.com/soft-delete-days"
+)
+
+// Keys read from the CSI secrets of a StorageClass's csi.storage.k8s.io/provisioner-secret-name,
+// controller-publish-secret-name and controller-expand-secret-name, to use another Civo account's volumes
+const (
+	// SecretAPIKey is the Civo API key to use for the volume, the driver's own is used if there are no secrets
+	SecretAPIKey = "api-key"
+
+	// SecretAPIURL is the Civo API URL to use with the SecretAPIKey, the driver's own if it's not set
+	SecretAPIURL = "api-url"
+)
+
+// Keys ControllerPublishVolume sets in the PublishContext, which is passed to the node with the stage and publish
+// calls for that attachment
+const (
+	// PublishContextReadOnly is "true" if the volume was attached read-only, so the node must never write to it
+	PublishContextReadOnly = "csi.civo.com/read-only"
+)
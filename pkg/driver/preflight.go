@@ -0,0 +1,170 @@
+package driver
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultFilesystem is the filesystem volumes are formatted with when none is requested
+const DefaultFilesystem string = "ext4"
+
+// procFilesystemsPath lists the filesystems the running kernel currently supports
+const procFilesystemsPath string = "/proc/filesystems"
+
+// hostTool is an executable the node plugin shells out to
+type hostTool struct {
+	// path is either looked up in $PATH or, if absolute, used as is
+	path string
+	// versionArgs are passed to the tool to get it to print its version
+	versionArgs []string
+}
+
+// commonHostTools are needed whichever filesystem is used
+var commonHostTools = []hostTool{
+	{path: "blkid", versionArgs: []string{"-V"}},
+	{path: "mount", versionArgs: []string{"-V"}},
+	{path: "umount", versionArgs: []string{"-V"}},
+}
+
+// ParseFilesystems converts a comma separated list of filesystems (e.g. from a command line flag) into the
+// filesystems the node plugin must support, ignoring spaces around them and empty entries
+func ParseFilesystems(s string) ([]string, error) {
+	filesystems := []string{}
+	for _, fs := range strings.Split(s, ",") {
+		if fs = strings.TrimSpace(fs); fs != "" {
+			filesystems = append(filesystems, fs)
+		}
+	}
+	if len(filesystems) == 0 {
+		return nil, fmt.Errorf("no filesystems in %q", s)
+	}
+	return filesystems, nil
+}
+
+// udevHostTool is needed to trigger udev and wait for it to settle, if the node plugin does
+var udevHostTool = hostTool{path: "udevadm", versionArgs: []string{"--version"}}
+
+// filesystemHostTools are the tools needed to format, check and grow each supported filesystem
+var filesystemHostTools = map[string][]hostTool{
+	"ext4": {
+		{path: "mkfs.ext4", versionArgs: []string{"-V"}},
+		// resize2fs prints its version as the first line of its usage
+		{path: "resize2fs"},
+		{path: "e2fsck", versionArgs: []string{"-V"}},
+	},
+	"xfs": {
+		{path: "mkfs.xfs", versionArgs: []string{"-V"}},
+		{path: "xfs_growfs", versionArgs: []string{"-V"}},
+		{path: "xfs_repair", versionArgs: []string{"-V"}},
+	},
+}
+
+// Preflight checks that every tool needed to format, mount and grow the given filesystems is installed and that
+// the kernel supports them, and that udevadm is installed if udevSettle is set, logging the version of each tool
+// found. It returns an error describing everything that's missing so the node plugin can refuse to start on an
+// incompatible host image.
+func (p *RealDiskHotPlugger) Preflight(filesystems []string, udevSettle bool) error {
+	tools := append([]hostTool{}, commonHostTools...)
+	if udevSettle {
+		tools = append(tools, udevHostTool)
+	}
+	for _, fs := range filesystems {
+		fsTools, ok := filesystemHostTools[fs]
+		if !ok {
+			return fmt.Errorf("filesystem %q isn't supported", fs)
+		}
+		tools = append(tools, fsTools...)
+	}
+
+	problems := []string{}
+
+	for _, tool := range tools {
+		path, err := exec.LookPath(tool.path)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s executable not found: %v", tool.path, err))
+			continue
+		}
+		log.Info().Str("tool", tool.path).Str("path", path).Str("version", toolVersion(path, tool.versionArgs)).Msg("Found host tool")
+	}
+
+	for _, fs := range filesystems {
+		supported, err := kernelSupportsFilesystem(fs)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("unable to check kernel support for %s: %v", fs, err))
+			continue
+		}
+		if !supported {
+			problems = append(problems, fmt.Sprintf("kernel doesn't support the %s filesystem", fs))
+			continue
+		}
+		log.Info().Str("filesystem", fs).Msg("Kernel supports filesystem")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("host is incompatible with the node plugin: %s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// toolVersion returns the first line of output from running the tool to print its version, it's only used for
+// logging so failures are reported rather than returned
+func toolVersion(path string, args []string) string {
+	// Tools without a version flag print it alongside their usage and exit non-zero, so the error is ignored
+	// as long as something was printed
+	output, err := exec.Command(path, args...).CombinedOutput()
+	line := strings.TrimSpace(strings.SplitN(strings.TrimSpace(string(output)), "\n", 2)[0])
+	if line == "" {
+		if err != nil {
+			return fmt.Sprintf("unknown (%v)", err)
+		}
+		return "unknown"
+	}
+	return line
+}
+
+// kernelSupportsFilesystem checks /proc/filesystems for the filesystem, trying to load its module if it isn't
+// there yet (modules are usually only loaded on first use)
+func kernelSupportsFilesystem(fs string) (bool, error) {
+	supported, err := procFilesystemsContains(fs)
+	if err != nil || supported {
+		return supported, err
+	}
+
+	if _, err := exec.LookPath("modprobe"); err != nil {
+		return false, nil
+	}
+
+	output, err := exec.Command("modprobe", fs).CombinedOutput()
+	if err != nil {
+		log.Debug().Str("filesystem", fs).Str("output", string(output)).Err(err).Msg("Unable to load filesystem module")
+		return false, nil
+	}
+
+	return procFilesystemsContains(fs)
+}
+
+// procFilesystemsContains returns true if the filesystem is listed in /proc/filesystems
+func procFilesystemsContains(fs string) (bool, error) {
+	content, err := os.ReadFile(procFilesystemsPath)
+	if err != nil {
+		return false, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		// Lines are either "\text4" or "nodev\tproc"
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 && fields[len(fields)-1] == fs {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
@@ -0,0 +1,91 @@
+package driver
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/civo/civogo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// quotaReservations is a ledger of the volumes this controller is part way through creating. The Civo API's quota
+// doesn't count a volume until it exists and CreateVolume is only serialised per name, so without the ledger
+// parallel creates with different names would all pass the quota check and then fail in the Civo API.
+type quotaReservations struct {
+	mu sync.Mutex
+	// pending is the size in GB of each volume being created, by its Civo volume name
+	pending map[string]int64
+}
+
+// reserve holds sizeGB of the quota for the named volume until the returned function is called. It fails with
+// ResourceExhausted, listing the volumes being created, if the quota doesn't have room for the volume as well.
+func (r *quotaReservations) reserve(name string, sizeGB int64, quota *civogo.Quota) (func(), error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reservedGB, reservedCount := r.totalLocked()
+	availableGB := int64(quota.DiskGigabytesLimit-quota.DiskGigabytesUsage) - reservedGB
+
+	if availableGB < sizeGB {
+		return nil, status.Errorf(codes.ResourceExhausted, "Requested volume would exceed volume space quota by %d GB%s", sizeGB-availableGB, r.pendingMessageLocked())
+	}
+	if quota.DiskVolumeCountUsage+reservedCount >= quota.DiskVolumeCountLimit {
+		return nil, status.Errorf(codes.ResourceExhausted, "Requested volume would exceed volume count limit quota of %d%s", quota.DiskVolumeCountLimit, r.pendingMessageLocked())
+	}
+
+	if r.pending == nil {
+		r.pending = map[string]int64{}
+	}
+	r.pending[name] = sizeGB
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.pending, name)
+	}, nil
+}
+
+// reserved returns true if the named volume is being created
+func (r *quotaReservations) reserved(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.pending[name]
+	return ok
+}
+
+// total returns the size in GB and number of the volumes being created
+func (r *quotaReservations) total() (int64, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.totalLocked()
+}
+
+func (r *quotaReservations) totalLocked() (int64, int) {
+	var sizeGB int64
+	for _, size := range r.pending {
+		sizeGB += size
+	}
+	return sizeGB, len(r.pending)
+}
+
+// pendingMessageLocked describes the volumes being created for an error message, e.g. ", pending: a (10GB), b (5GB)"
+func (r *quotaReservations) pendingMessageLocked() string {
+	if len(r.pending) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(r.pending))
+	for name := range r.pending {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	reservations := make([]string, 0, len(names))
+	for _, name := range names {
+		reservations = append(reservations, fmt.Sprintf("%s (%dGB)", name, r.pending[name]))
+	}
+	return ", pending: " + strings.Join(reservations, ", ")
+}
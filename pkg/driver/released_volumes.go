@@ -0,0 +1,290 @@
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/civo/civogo"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// ReleasedVolumesConfigMap is the name of the ConfigMap that records the volumes DeleteVolume released instead of
+// deleting. The Civo API can't tag a volume, so they're recorded in Kubernetes instead.
+const ReleasedVolumesConfigMap = "civo-csi-released-volumes"
+
+// DefaultReleasedVolumesNamespace is the namespace of the ReleasedVolumesConfigMap, the controller's namespace
+const DefaultReleasedVolumesNamespace = "kube-system"
+
+// DefaultSoftDeleteDays is how many days a soft-deleted volume is kept for if its StorageClass doesn't say
+const DefaultSoftDeleteDays = 7
+
+// DeletionPolicy describes what DeleteVolume does with a volume's Civo volume
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete deletes the Civo volume
+	DeletionPolicyDelete DeletionPolicy = "delete"
+	// DeletionPolicyProtect refuses to delete the volume, DeleteVolume fails until the policy is changed
+	DeletionPolicyProtect DeletionPolicy = "protect"
+	// DeletionPolicyRetain detaches the Civo volume and records it as released, it's never deleted by the driver
+	DeletionPolicyRetain DeletionPolicy = "retain"
+	// DeletionPolicySoftDelete detaches the Civo volume and records it as released, and it's deleted by the orphaned
+	// volume collector once it's been released for the soft delete days
+	DeletionPolicySoftDelete DeletionPolicy = "soft-delete"
+)
+
+// parseDeletionPolicy returns the deletion policy and soft delete days in a StorageClass's parameters or a volume's
+// VolumeContext, which share their keys
+func parseDeletionPolicy(attributes map[string]string) (DeletionPolicy, int, error) {
+	policy := DeletionPolicyDelete
+	if value, ok := attributes[ParameterDeletionPolicy]; ok {
+		switch p := DeletionPolicy(value); p {
+		case DeletionPolicyDelete, DeletionPolicyProtect, DeletionPolicyRetain, DeletionPolicySoftDelete:
+			policy = p
+		default:
+			return "", 0, fmt.Errorf("%s must be one of %q, %q, %q or %q, not %q", ParameterDeletionPolicy, DeletionPolicyDelete, DeletionPolicyProtect, DeletionPolicyRetain, DeletionPolicySoftDelete, value)
+		}
+	}
+
+	days := DefaultSoftDeleteDays
+	if value, ok := attributes[ParameterSoftDeleteDays]; ok {
+		var err error
+		days, err = strconv.Atoi(value)
+		if err != nil || days < 1 {
+			return "", 0, fmt.Errorf("%s must be a whole number of days, at least 1, not %q", ParameterSoftDeleteDays, value)
+		}
+	}
+
+	return policy, days, nil
+}
+
+// releasedVolume is a volume's entry in the ReleasedVolumesConfigMap, keyed by the volume ID
+type releasedVolume struct {
+	// PersistentVolume is the name of the PV the volume was released from
+	PersistentVolume string `json:"persistentVolume"`
+	// ReleasedAt is when DeleteVolume released the volume
+	ReleasedAt time.Time `json:"releasedAt"`
+	// DeleteAfter is when a soft-deleted volume can be deleted, it's nil for retained volumes
+	DeleteAfter *time.Time `json:"deleteAfter,omitempty"`
+	// SecretRef is the secret with the API key of the Civo account the volume is in, nil for the driver's own
+	SecretRef *v1.SecretReference `json:"secretRef,omitempty"`
+}
+
+// releasedVolumes returns the volumes recorded in the ReleasedVolumesConfigMap, by volume ID
+func (d *Driver) releasedVolumes(ctx context.Context) (map[string]releasedVolume, error) {
+	cm, err := d.KubeClient.CoreV1().ConfigMaps(d.ReleasedVolumesNamespace).Get(ctx, ReleasedVolumesConfigMap, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return map[string]releasedVolume{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get ConfigMap %s/%s: %w", d.ReleasedVolumesNamespace, ReleasedVolumesConfigMap, err)
+	}
+
+	released := map[string]releasedVolume{}
+	for volumeID, value := range cm.Data {
+		var rv releasedVolume
+		if err := json.Unmarshal([]byte(value), &rv); err != nil {
+			log.Warn().Err(err).Str("volume_id", volumeID).Msg("Ignoring released volume that can't be parsed")
+			continue
+		}
+		released[volumeID] = rv
+	}
+	return released, nil
+}
+
+// updateReleasedVolumes records (or with a nil entry, forgets) a released volume in the ReleasedVolumesConfigMap,
+// creating it if it doesn't exist
+func (d *Driver) updateReleasedVolumes(ctx context.Context, volumeID string, rv *releasedVolume) error {
+	configMaps := d.KubeClient.CoreV1().ConfigMaps(d.ReleasedVolumesNamespace)
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := configMaps.Get(ctx, ReleasedVolumesConfigMap, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			if rv == nil {
+				return nil
+			}
+			cm = &v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: ReleasedVolumesConfigMap, Namespace: d.ReleasedVolumesNamespace},
+			}
+			cm, err = configMaps.Create(ctx, cm, metav1.CreateOptions{})
+		}
+		if err != nil {
+			return err
+		}
+
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		if rv == nil {
+			if _, ok := cm.Data[volumeID]; !ok {
+				return nil
+			}
+			delete(cm.Data, volumeID)
+		} else {
+			value, err := json.Marshal(rv)
+			if err != nil {
+				return err
+			}
+			cm.Data[volumeID] = string(value)
+		}
+
+		_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// applyDeletionPolicy applies the deletion policy of the volume's PersistentVolume, returning true if the volume should
+// be deleted. The policy in the PV's volumeAttributes, which can't be changed, is overridden by a
+// csi.civo.com/deletion-policy annotation on the PV. If the PV has already gone, e.g. DeleteVolume is retried after it
+// released the volume, volumes recorded as released are left alone. client is the Civo API client for the volume's
+// account.
+func (d *Driver) applyDeletionPolicy(ctx context.Context, client civogo.Clienter, volumeID string) (bool, error) {
+	pv, err := d.lookupPersistentVolume(ctx, volumeID)
+	if err != nil {
+		return false, status.Errorf(codes.Unavailable, "cannot find the PersistentVolume of volume %s to check its deletion policy: %s", volumeID, err)
+	}
+
+	if pv == nil {
+		released, err := d.releasedVolumes(ctx)
+		if err != nil {
+			return false, status.Errorf(codes.Unavailable, "cannot check if volume %s was released: %s", volumeID, err)
+		}
+		if _, ok := released[volumeID]; ok {
+			log.Info().Str("volume_id", volumeID).Msg("Volume was released, not deleting it")
+			return false, nil
+		}
+		return true, nil
+	}
+
+	attributes := map[string]string{}
+	for key, value := range pv.Spec.CSI.VolumeAttributes {
+		attributes[key] = value
+	}
+	if policy, ok := pv.Annotations[ParameterDeletionPolicy]; ok {
+		attributes[ParameterDeletionPolicy] = policy
+	}
+
+	policy, softDeleteDays, err := parseDeletionPolicy(attributes)
+	if err != nil {
+		return false, status.Errorf(codes.FailedPrecondition, "PersistentVolume %s has an invalid deletion policy: %s", pv.Name, err)
+	}
+
+	switch policy {
+	case DeletionPolicyProtect:
+		log.Warn().Str("volume_id", volumeID).Str("pv", pv.Name).Msg("Refusing to delete protected volume")
+		d.recordVolumeEvent(ctx, volumeID, v1.EventTypeWarning, "DeletionRefused", "Refusing to delete volume %s as its deletion policy is %q", volumeID, policy)
+		return false, status.Errorf(codes.FailedPrecondition, "volume %s is protected from deletion, annotate PersistentVolume %s with %s: %s to delete it", volumeID, pv.Name, ParameterDeletionPolicy, DeletionPolicyDelete)
+	case DeletionPolicyRetain, DeletionPolicySoftDelete:
+		return false, d.releaseVolume(ctx, client, pv, policy, softDeleteDays)
+	}
+
+	return true, nil
+}
+
+// releaseVolume detaches the volume if it's attached and records it as released instead of deleting it, for volumes
+// with the retain and soft-delete deletion policies
+func (d *Driver) releaseVolume(ctx context.Context, client civogo.Clienter, pv *v1.PersistentVolume, policy DeletionPolicy, softDeleteDays int) error {
+	volumeID := pv.Spec.CSI.VolumeHandle
+
+	volume, err := client.GetVolume(volumeID)
+	if err != nil {
+		if strings.Contains(err.Error(), "DatabaseVolumeNotFoundError") || strings.Contains(err.Error(), "ZeroMatchesError") {
+			log.Info().Str("volume_id", volumeID).Msg("Volume already deleted from Civo API, nothing to release")
+			return nil
+		}
+		log.Error().Err(err).Msg("Unable to find volume for releasing in Civo API")
+		return err
+	}
+
+	if volume.InstanceID != "" && volume.Status != "available" {
+		log.Info().Str("volume_id", volume.ID).Str("instance_id", volume.InstanceID).Msg("Detaching volume to release it")
+		if _, err := client.DetachVolume(volume.ID); err != nil {
+			log.Error().Err(err).Str("volume_id", volume.ID).Msg("Unable to detach volume in Civo API")
+			return status.Errorf(codes.Internal, "cannot detach volume %s to release it: %s", volume.ID, err)
+		}
+		available, err := d.waitForVolumeStatus(client, volume, "available", CivoVolumeAvailableRetries)
+		if err != nil || !available {
+			return status.Errorf(codes.Unavailable, "volume %s didn't detach: %v", volume.ID, err)
+		}
+	}
+
+	rv := releasedVolume{
+		PersistentVolume: pv.Name,
+		ReleasedAt:       time.Now().UTC(),
+		SecretRef:        persistentVolumeSecretRef(pv),
+	}
+	if policy == DeletionPolicySoftDelete {
+		deleteAfter := rv.ReleasedAt.AddDate(0, 0, softDeleteDays)
+		rv.DeleteAfter = &deleteAfter
+	}
+
+	if err := d.updateReleasedVolumes(ctx, volume.ID, &rv); err != nil {
+		log.Error().Err(err).Str("volume_id", volume.ID).Msg("Unable to record released volume")
+		return status.Errorf(codes.Unavailable, "cannot record volume %s as released: %s", volume.ID, err)
+	}
+
+	if rv.DeleteAfter != nil {
+		log.Info().Str("volume_id", volume.ID).Time("delete_after", *rv.DeleteAfter).Msg("Volume soft-deleted")
+		d.recordVolumeEvent(ctx, volume.ID, v1.EventTypeNormal, "VolumeReleased", "Released volume %s instead of deleting it, it will be deleted after %s", volume.ID, rv.DeleteAfter.Format(time.RFC3339))
+	} else {
+		log.Info().Str("volume_id", volume.ID).Msg("Volume retained")
+		d.recordVolumeEvent(ctx, volume.ID, v1.EventTypeNormal, "VolumeReleased", "Released volume %s instead of deleting it, it must be deleted by hand", volume.ID)
+	}
+
+	return nil
+}
+
+// collectReleasedVolumes deletes the soft-deleted volumes that have been released for long enough, and forgets
+// released volumes that no longer exist or have a PersistentVolume again, unless their account couldn't be searched.
+// It returns the number of volumes still released.
+func (d *Driver) collectReleasedVolumes(ctx context.Context, scan *volumeScan, now time.Time) int {
+	remaining := 0
+
+	for volumeID, rv := range scan.released {
+		volume, ok := scan.unclaimed[volumeID]
+		if !ok && scan.failed[secretRefKey(rv.SecretRef)] {
+			remaining++
+			continue
+		}
+		if !ok {
+			log.Debug().Str("volume_id", volumeID).Msg("Forgetting released volume that's been deleted or reused")
+			if err := d.updateReleasedVolumes(ctx, volumeID, nil); err != nil {
+				log.Error().Err(err).Str("volume_id", volumeID).Msg("Unable to forget released volume")
+			}
+			continue
+		}
+
+		if rv.DeleteAfter == nil || now.Before(*rv.DeleteAfter) || volume.InstanceID != "" {
+			remaining++
+			continue
+		}
+
+		log.Info().Str("volume_id", volumeID).Time("delete_after", *rv.DeleteAfter).Msg("Deleting soft-deleted volume")
+		if _, err := volume.client.DeleteVolume(volumeID); err != nil {
+			log.Error().Err(err).Str("volume_id", volumeID).Msg("Unable to delete soft-deleted volume in Civo API")
+			remaining++
+			continue
+		}
+		d.recordVolumeEvent(ctx, volumeID, v1.EventTypeNormal, "SoftDeletedVolumeDeleted", "Deleted volume %s, released from %s at %s", volumeID, rv.PersistentVolume, rv.ReleasedAt.Format(time.RFC3339))
+
+		if err := d.updateReleasedVolumes(ctx, volumeID, nil); err != nil {
+			log.Error().Err(err).Str("volume_id", volumeID).Msg("Unable to forget deleted volume")
+		}
+
+		d.metrics.mu.Lock()
+		d.metrics.softDeletedVolumesDeleted++
+		d.metrics.mu.Unlock()
+	}
+
+	return remaining
+}
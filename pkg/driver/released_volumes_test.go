@@ -0,0 +1,217 @@
+package driver_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/civo/civo-csi/pkg/driver"
+	"github.com/civo/civogo"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDeletionPolicy(t *testing.T) {
+	// newDriver returns a driver with an attached volume, whose PV has the given volume attributes and annotations
+	newDriver := func(attributes, annotations map[string]string) (*driver.Driver, *civogo.FakeClient) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+		fc.Volumes = []civogo.Volume{{ID: "vol-1", ClusterID: d.ClusterID, InstanceID: "i-12345678", Status: "attached", SizeGigabytes: 10}}
+		d.KubeClient = fake.NewSimpleClientset(&v1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pvc-1", Annotations: annotations},
+			Spec: v1.PersistentVolumeSpec{
+				PersistentVolumeSource: v1.PersistentVolumeSource{
+					CSI: &v1.CSIPersistentVolumeSource{
+						Driver:           driver.DriverName,
+						VolumeHandle:     "vol-1",
+						VolumeAttributes: attributes,
+					},
+				},
+			},
+		})
+		return d, fc
+	}
+
+	// released returns the volumes recorded as released
+	released := func(t *testing.T, d *driver.Driver) map[string]map[string]interface{} {
+		volumes := map[string]map[string]interface{}{}
+		cm, err := d.KubeClient.CoreV1().ConfigMaps(driver.DefaultReleasedVolumesNamespace).Get(context.Background(), driver.ReleasedVolumesConfigMap, metav1.GetOptions{})
+		if err != nil {
+			return volumes
+		}
+		for volumeID, value := range cm.Data {
+			var rv map[string]interface{}
+			assert.Nil(t, json.Unmarshal([]byte(value), &rv))
+			volumes[volumeID] = rv
+		}
+		return volumes
+	}
+
+	deletePV := func(t *testing.T, d *driver.Driver) {
+		err := d.KubeClient.CoreV1().PersistentVolumes().Delete(context.Background(), "pvc-1", metav1.DeleteOptions{})
+		assert.Nil(t, err)
+	}
+
+	t.Run("Deletes a volume by default", func(t *testing.T) {
+		d, fc := newDriver(nil, nil)
+
+		_, err := d.DeleteVolume(context.Background(), &csi.DeleteVolumeRequest{VolumeId: "vol-1"})
+		assert.Nil(t, err)
+		assert.Empty(t, fc.Volumes)
+	})
+
+	t.Run("Refuses to delete a protected volume", func(t *testing.T) {
+		d, fc := newDriver(map[string]string{driver.VolumeContextDeletionPolicy: "protect"}, nil)
+
+		_, err := d.DeleteVolume(context.Background(), &csi.DeleteVolumeRequest{VolumeId: "vol-1"})
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+		assert.Len(t, fc.Volumes, 1)
+	})
+
+	t.Run("Deletes a protected volume if the PV's annotation allows it", func(t *testing.T) {
+		d, fc := newDriver(
+			map[string]string{driver.VolumeContextDeletionPolicy: "protect"},
+			map[string]string{driver.ParameterDeletionPolicy: "delete"},
+		)
+
+		_, err := d.DeleteVolume(context.Background(), &csi.DeleteVolumeRequest{VolumeId: "vol-1"})
+		assert.Nil(t, err)
+		assert.Empty(t, fc.Volumes)
+	})
+
+	t.Run("Retains a volume", func(t *testing.T) {
+		d, fc := newDriver(map[string]string{driver.VolumeContextDeletionPolicy: "retain"}, nil)
+		d.OrphanGracePeriod = 0
+		d.OrphanDeletion = driver.OrphanDeletionOn
+
+		_, err := d.DeleteVolume(context.Background(), &csi.DeleteVolumeRequest{VolumeId: "vol-1"})
+		assert.Nil(t, err)
+		assert.Len(t, fc.Volumes, 1)
+		assert.Equal(t, "available", fc.Volumes[0].Status)
+		assert.Contains(t, released(t, d), "vol-1")
+		assert.NotContains(t, released(t, d)["vol-1"], "deleteAfter")
+
+		// Once the PV has gone, neither a retried DeleteVolume nor the orphaned volume collector delete it
+		deletePV(t, d)
+		_, err = d.DeleteVolume(context.Background(), &csi.DeleteVolumeRequest{VolumeId: "vol-1"})
+		assert.Nil(t, err)
+		assert.Nil(t, d.CollectOrphanedVolumes(context.Background()))
+		assert.Len(t, fc.Volumes, 1)
+		assert.Contains(t, released(t, d), "vol-1")
+	})
+
+	t.Run("Soft deletes a volume", func(t *testing.T) {
+		d, fc := newDriver(map[string]string{
+			driver.VolumeContextDeletionPolicy: "soft-delete",
+			driver.VolumeContextSoftDeleteDays: "3",
+		}, nil)
+
+		_, err := d.DeleteVolume(context.Background(), &csi.DeleteVolumeRequest{VolumeId: "vol-1"})
+		assert.Nil(t, err)
+		assert.Len(t, fc.Volumes, 1)
+
+		rv := released(t, d)["vol-1"]
+		releasedAt, _ := time.Parse(time.RFC3339, rv["releasedAt"].(string))
+		deleteAfter, _ := time.Parse(time.RFC3339, rv["deleteAfter"].(string))
+		assert.Equal(t, 3*24*time.Hour, deleteAfter.Sub(releasedAt))
+
+		// It's kept until it's been released for long enough
+		deletePV(t, d)
+		assert.Nil(t, d.CollectOrphanedVolumes(context.Background()))
+		assert.Len(t, fc.Volumes, 1)
+
+		cm, _ := d.KubeClient.CoreV1().ConfigMaps(driver.DefaultReleasedVolumesNamespace).Get(context.Background(), driver.ReleasedVolumesConfigMap, metav1.GetOptions{})
+		cm.Data["vol-1"] = `{"persistentVolume":"pvc-1","releasedAt":"2020-01-01T00:00:00Z","deleteAfter":"2020-01-04T00:00:00Z"}`
+		_, err = d.KubeClient.CoreV1().ConfigMaps(driver.DefaultReleasedVolumesNamespace).Update(context.Background(), cm, metav1.UpdateOptions{})
+		assert.Nil(t, err)
+
+		assert.Nil(t, d.CollectOrphanedVolumes(context.Background()))
+		assert.Empty(t, fc.Volumes)
+		assert.Empty(t, released(t, d))
+
+		rec := httptest.NewRecorder()
+		d.HealthHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		assert.Contains(t, rec.Body.String(), "civo_csi_soft_deleted_volumes_deleted_total 1\n")
+	})
+
+	t.Run("Soft deletes a volume in another Civo account", func(t *testing.T) {
+		d, fc := newDriver(nil, nil)
+		teamA, _ := civogo.NewFakeClient()
+		teamA.Volumes = fc.Volumes
+		fc.Volumes = nil
+		d.NewCivoClient = func(apiKey, apiURL, region string) (civogo.Clienter, error) {
+			return teamA, nil
+		}
+
+		ref := &v1.SecretReference{Name: "team-a", Namespace: "kube-system"}
+		_, err := d.KubeClient.CoreV1().Secrets("kube-system").Create(context.Background(), &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "team-a", Namespace: "kube-system"},
+			Data:       map[string][]byte{driver.SecretAPIKey: []byte("team-a-key")},
+		}, metav1.CreateOptions{})
+		assert.Nil(t, err)
+		pv, _ := d.KubeClient.CoreV1().PersistentVolumes().Get(context.Background(), "pvc-1", metav1.GetOptions{})
+		pv.Spec.CSI.VolumeAttributes = map[string]string{driver.VolumeContextDeletionPolicy: "soft-delete"}
+		pv.Spec.CSI.ControllerPublishSecretRef = ref
+		_, err = d.KubeClient.CoreV1().PersistentVolumes().Update(context.Background(), pv, metav1.UpdateOptions{})
+		assert.Nil(t, err)
+
+		_, err = d.DeleteVolume(context.Background(), &csi.DeleteVolumeRequest{VolumeId: "vol-1", Secrets: map[string]string{driver.SecretAPIKey: "team-a-key"}})
+		assert.Nil(t, err)
+		assert.Equal(t, "available", teamA.Volumes[0].Status)
+		assert.Equal(t, map[string]interface{}{"name": "team-a", "namespace": "kube-system"}, released(t, d)["vol-1"]["secretRef"])
+
+		// The record is kept while the volume's account can't be searched
+		deletePV(t, d)
+		cm, _ := d.KubeClient.CoreV1().ConfigMaps(driver.DefaultReleasedVolumesNamespace).Get(context.Background(), driver.ReleasedVolumesConfigMap, metav1.GetOptions{})
+		cm.Data["vol-1"] = `{"persistentVolume":"pvc-1","releasedAt":"2020-01-01T00:00:00Z","deleteAfter":"2020-01-04T00:00:00Z","secretRef":{"name":"team-a","namespace":"kube-system"}}`
+		_, err = d.KubeClient.CoreV1().ConfigMaps(driver.DefaultReleasedVolumesNamespace).Update(context.Background(), cm, metav1.UpdateOptions{})
+		assert.Nil(t, err)
+		d.NewCivoClient = func(apiKey, apiURL, region string) (civogo.Clienter, error) {
+			return nil, errors.New("invalid API key")
+		}
+		d.CivoAccountIdleTimeout = 0
+		assert.Nil(t, d.CollectOrphanedVolumes(context.Background()))
+		assert.Len(t, teamA.Volumes, 1)
+		assert.Contains(t, released(t, d), "vol-1")
+
+		// Once it can, the expired volume is deleted from its own account
+		d.NewCivoClient = func(apiKey, apiURL, region string) (civogo.Clienter, error) {
+			return teamA, nil
+		}
+		assert.Nil(t, d.CollectOrphanedVolumes(context.Background()))
+		assert.Empty(t, teamA.Volumes)
+		assert.Empty(t, released(t, d))
+	})
+
+	t.Run("Refuses to delete a volume without a Kubernetes API client", func(t *testing.T) {
+		d, fc := newDriver(nil, nil)
+		d.KubeClient = nil
+
+		_, err := d.DeleteVolume(context.Background(), &csi.DeleteVolumeRequest{VolumeId: "vol-1"})
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+		assert.Len(t, fc.Volumes, 1)
+	})
+
+	t.Run("Rejects an invalid deletion policy", func(t *testing.T) {
+		d, _ := driver.NewTestDriver(nil)
+
+		for _, parameters := range []map[string]string{
+			{driver.ParameterDeletionPolicy: "never"},
+			{driver.ParameterDeletionPolicy: "soft-delete", driver.ParameterSoftDeleteDays: "0"},
+		} {
+			req := minimalVolumeRequest("foo")
+			req.Parameters = parameters
+			_, err := d.CreateVolume(context.Background(), req)
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package driver
+
+import (
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TopologyRegionKey is the topology segment for the Civo region, which nodes report in NodeGetInfo and volumes are
+// accessible from. Volumes can only be attached to instances in the same region.
+const TopologyRegionKey string = "region"
+
+// volumeTopology returns where volumes created by this controller are accessible from, which is only ever the
+// region its Civo API client is for
+func (d *Driver) volumeTopology() []*csi.Topology {
+	if d.Region == "" {
+		return nil
+	}
+
+	return []*csi.Topology{
+		{
+			Segments: map[string]string{
+				TopologyRegionKey: d.Region,
+			},
+		},
+	}
+}
+
+// checkAccessibilityRequirements returns ResourceExhausted if the requisite topology doesn't include the
+// controller's region, as that's the only region it can create volumes in. The preferred topology is a subset of
+// the requisite one, so it doesn't need checking beyond being logged if it can't be honoured.
+func (d *Driver) checkAccessibilityRequirements(requirement *csi.TopologyRequirement) error {
+	if requirement == nil || d.Region == "" {
+		return nil
+	}
+
+	if requisite := requirement.GetRequisite(); len(requisite) > 0 && !topologiesInclude(requisite, d.Region) {
+		log.Error().Str("region", d.Region).Interface("requisite", requisite).Msg("Requisite topology doesn't include the controller's region")
+		return status.Errorf(codes.ResourceExhausted, "volumes can only be created in region %q, which isn't in the requisite topology", d.Region)
+	}
+
+	if preferred := requirement.GetPreferred(); len(preferred) > 0 && !topologiesInclude(preferred, d.Region) {
+		log.Warn().Str("region", d.Region).Interface("preferred", preferred).Msg("Preferred topology doesn't include the controller's region, creating the volume there anyway")
+	}
+
+	return nil
+}
+
+// topologiesInclude returns true if any of the topologies is in the region, or doesn't say which region it's in
+func topologiesInclude(topologies []*csi.Topology, region string) bool {
+	for _, topology := range topologies {
+		if segment, ok := topology.GetSegments()[TopologyRegionKey]; !ok || segment == region {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/rs/zerolog/log"
+)
+
+// VolumeNameData is what a volume name template can use, from the metadata external-provisioner passes to
+// CreateVolume when it's run with --extra-create-metadata
+type VolumeNameData struct {
+	// PVName is the name of the PersistentVolume, which is also the CreateVolume request's name
+	PVName string
+	// PVCName and PVCNamespace are the name and namespace of the PersistentVolumeClaim the volume is for
+	PVCName      string
+	PVCNamespace string
+}
+
+// ParseVolumeNameTemplate parses a text/template for the names of the Civo volumes CreateVolume creates, e.g.
+// "{{ .PVCNamespace }}-{{ .PVCName }}-{{ .PVName }}". The name must include the PV's name, as CreateVolume finds
+// the volume it created by name when it's retried.
+func ParseVolumeNameTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("volume-name").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parse volume name template: %w", err)
+	}
+
+	example := VolumeNameData{PVName: "pvc-6d4b4d4a-0b3c-4b8e-9d5e-1a2b3c4d5e6f", PVCName: "data", PVCNamespace: "default"}
+	name, err := executeVolumeNameTemplate(tmpl, example)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.Contains(name, example.PVName) {
+		return nil, errors.New("volume name template must include {{ .PVName }}")
+	}
+
+	return tmpl, nil
+}
+
+// executeVolumeNameTemplate returns the volume name the template gives for the data
+func executeVolumeNameTemplate(tmpl *template.Template, data VolumeNameData) (string, error) {
+	var name strings.Builder
+	if err := tmpl.Execute(&name, data); err != nil {
+		return "", fmt.Errorf("execute volume name template: %w", err)
+	}
+	return strings.TrimSpace(name.String()), nil
+}
+
+// volumeName returns the name of the Civo volume to create for the request. That's the request's name unless
+// there's a VolumeNameTemplate and the request has the PVC's name and namespace.
+func (d *Driver) volumeName(req *csi.CreateVolumeRequest) (string, error) {
+	if d.VolumeNameTemplate == nil {
+		return req.Name, nil
+	}
+
+	data := VolumeNameData{
+		PVName:       req.GetParameters()[ParameterPVName],
+		PVCName:      req.GetParameters()[ParameterPVCName],
+		PVCNamespace: req.GetParameters()[ParameterPVCNamespace],
+	}
+	if data.PVName == "" {
+		data.PVName = req.Name
+	}
+	if data.PVCName == "" || data.PVCNamespace == "" {
+		log.Debug().Str("name", req.Name).Msg("CreateVolume request has no PVC metadata, is external-provisioner run with --extra-create-metadata?")
+		return req.Name, nil
+	}
+
+	return executeVolumeNameTemplate(d.VolumeNameTemplate, data)
+}
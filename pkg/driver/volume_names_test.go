@@ -0,0 +1,76 @@
+package driver_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/civo/civo-csi/pkg/driver"
+	"github.com/civo/civogo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVolumeNameTemplate(t *testing.T) {
+	metadata := map[string]string{
+		driver.ParameterPVName:       "pvc-1234",
+		driver.ParameterPVCName:      "data",
+		driver.ParameterPVCNamespace: "shop",
+	}
+
+	newDriver := func(t *testing.T) (*driver.Driver, *civogo.FakeClient) {
+		fc, _ := civogo.NewFakeClient()
+		d, _ := driver.NewTestDriver(fc)
+		tmpl, err := driver.ParseVolumeNameTemplate("{{ .PVCNamespace }}-{{ .PVCName }}-{{ .PVName }}")
+		assert.Nil(t, err)
+		d.VolumeNameTemplate = tmpl
+		return d, fc
+	}
+
+	t.Run("Names the volume from the PVC's metadata", func(t *testing.T) {
+		d, fc := newDriver(t)
+
+		req := minimalVolumeRequest("pvc-1234")
+		req.Parameters = metadata
+		resp, err := d.CreateVolume(context.Background(), req)
+		assert.Nil(t, err)
+		assert.Len(t, fc.Volumes, 1)
+		assert.Equal(t, "shop-data-pvc-1234", fc.Volumes[0].Name)
+
+		// A retry finds the volume by its templated name
+		retry, err := d.CreateVolume(context.Background(), req)
+		assert.Nil(t, err)
+		assert.Len(t, fc.Volumes, 1)
+		assert.Equal(t, resp.Volume.VolumeId, retry.Volume.VolumeId)
+	})
+
+	t.Run("Names the volume after the PV without the PVC's metadata", func(t *testing.T) {
+		d, fc := newDriver(t)
+
+		_, err := d.CreateVolume(context.Background(), minimalVolumeRequest("pvc-1234"))
+		assert.Nil(t, err)
+		assert.Len(t, fc.Volumes, 1)
+		assert.Equal(t, "pvc-1234", fc.Volumes[0].Name)
+	})
+
+	t.Run("Finds a volume created before the template was set", func(t *testing.T) {
+		d, fc := newDriver(t)
+		fc.Volumes = []civogo.Volume{{ID: "vol-1", Name: "pvc-1234", SizeGigabytes: 10, Status: "available"}}
+
+		req := minimalVolumeRequest("pvc-1234")
+		req.Parameters = metadata
+		resp, err := d.CreateVolume(context.Background(), req)
+		assert.Nil(t, err)
+		assert.Len(t, fc.Volumes, 1)
+		assert.Equal(t, "vol-1", resp.Volume.VolumeId)
+	})
+
+	t.Run("Rejects invalid templates", func(t *testing.T) {
+		for _, text := range []string{
+			"{{ .PVCName",
+			"{{ .PVCNamespace }}-{{ .PVCName }}",
+			"{{ .StorageClass }}-{{ .PVName }}",
+		} {
+			_, err := driver.ParseVolumeNameTemplate(text)
+			assert.NotNil(t, err, text)
+		}
+	})
+}